@@ -2,62 +2,226 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"flag"
 	"fmt"
 	"os"
 
+	"github.com/sheikhartin/bytecode-based-calculator/pkg/bytecode"
 	"github.com/sheikhartin/bytecode-based-calculator/pkg/interpreter"
 	"github.com/sheikhartin/bytecode-based-calculator/pkg/parser"
 )
 
+var (
+	lexerFlag     = flag.Bool("l", false, "Display lexer output")
+	parserFlag    = flag.Bool("p", false, "Display parser output")
+	generatorFlag = flag.Bool("g", false, "Display generated bytecodes")
+	notationFlag  = flag.String("n", "prefix", "Expression notation (prefix, infix or postfix)")
+	depthFlag     = flag.Int("r", interpreter.DefaultMaxDepth, "Maximum depth of nested function calls")
+	modeFlag      = flag.String("m", "float", "Number mode (float, bigfloat, rational or decimal)")
+	precisionFlag = flag.Uint("b", interpreter.DefaultPrecision, "Precision in bits of the bigfloat mode")
+	decimalsFlag  = flag.Int("d", 0, "Show rationals as decimals with this many places instead of fractions")
+	placesFlag    = flag.Int("s", interpreter.DefaultPlaces, "Decimal places kept by the decimal mode")
+	roundingFlag  = flag.String("round", "half-even", "Rounding mode of the decimal mode (half-even, half-up, down or ceiling)")
+	outputFlag    = flag.String("o", "", "Compile the given file into this bytecode file instead of running it")
+	stripFlag     = flag.Bool("strip", false, "Leave the source positions out of the compiled file")
+	asmFlag       = flag.Bool("asm", false, "Read the input as a bytecode listing instead of an expression")
+	disFlag       = flag.Bool("dis", false, "Display the disassembled program before running it")
+)
+
+func options(mode string) ([]interpreter.Option, error) {
+	switch mode {
+	case "float":
+		return nil, nil
+	case "bigfloat":
+		if *precisionFlag == 0 {
+			return nil, fmt.Errorf("The precision must be at least one bit!")
+		}
+		return []interpreter.Option{interpreter.WithBigFloat(*precisionFlag)}, nil
+	case "rational":
+		return []interpreter.Option{interpreter.WithRational()}, nil
+	case "decimal":
+		rounding, err := interpreter.ParseRounding(*roundingFlag)
+		if err != nil {
+			return nil, err
+		} else if *placesFlag < 0 {
+			return nil, fmt.Errorf("The number of decimal places cannot be negative!")
+		} else if *placesFlag > interpreter.MaxPlaces {
+			return nil, fmt.Errorf("The number of decimal places cannot exceed %d!", interpreter.MaxPlaces)
+		}
+		return []interpreter.Option{interpreter.WithDecimal(*placesFlag, rounding)}, nil
+	}
+	return nil, fmt.Errorf("Unknown number mode: %s", mode)
+}
+
+func parse(notation string, tokens []parser.Token, variables []string) (*parser.Parser, fmt.Stringer, error) {
+	switch notation {
+	case "prefix":
+		p, err := parser.NewParser(tokens, parser.WithVariables(variables))
+		return p, p, err
+	case "infix":
+		p, err := parser.NewInfixParser(tokens, parser.WithVariables(variables))
+		return &p.Parser, p, err
+	case "postfix":
+		p, err := parser.NewPostfixParser(tokens, parser.WithVariables(variables))
+		return &p.Parser, p, err
+	}
+	return nil, nil, fmt.Errorf("Unknown notation: %s", notation)
+}
+
+func compile(input string, variables []string) (bytecode.Program, error) {
+	l, err := parser.NewLexer(input)
+	if err != nil {
+		return bytecode.Program{}, err
+	}
+	if *lexerFlag {
+		fmt.Println("Tokenizing input...")
+		fmt.Println(l)
+	}
+
+	p, s, err := parse(*notationFlag, l.Tokens, variables)
+	if err != nil {
+		return bytecode.Program{}, err
+	}
+	if *parserFlag {
+		fmt.Println("Analyzing syntax...")
+		fmt.Println(s)
+	}
+
+	g := parser.NewBytecodeGenerator(p.Nodes, parser.WithPositions(p.Positions))
+	if *generatorFlag {
+		fmt.Println("Compiling instructions...")
+		fmt.Println(g)
+	}
+	return g.Program(), nil
+}
+
+// Compiled files are recognized by their magic bytes and run without the
+// parser, and so do bytecode listings with `-asm`. The variables are the names
+// assigned before, which hide units in the source.
+func load(source []byte, variables []string) (bytecode.Program, error) {
+	if *asmFlag {
+		return bytecode.Assemble(string(source))
+	} else if !bytes.HasPrefix(source, []byte(bytecode.Magic)) {
+		return compile(string(source), variables)
+	}
+	program, err := bytecode.Decode(source)
+	if err == nil && *generatorFlag {
+		fmt.Println("Loading instructions...")
+		fmt.Println(program)
+	}
+	return program, err
+}
+
+func evaluate(vm *interpreter.VM, source []byte) error {
+	program, err := load(source, vm.Variables())
+	if err != nil {
+		return err
+	}
+	if *disFlag {
+		fmt.Println("Disassembling...")
+		fmt.Println(bytecode.Disassemble(program))
+	}
+
+	// The postfix mode works like an HP calculator and keeps its stack
+	// between lines, so a failed line must not leave it half-consumed.
+	saved := append([]interface{}(nil), vm.Stack...)
+	if *notationFlag != "postfix" {
+		vm.Stack = vm.Stack[:0]
+	}
+	if err := vm.Execute(program); err != nil {
+		vm.Stack = saved
+		return err
+	}
+	return nil
+}
+
+func compileFile(output string) error {
+	if flag.NArg() != 1 {
+		return fmt.Errorf("Expected exactly one file to compile, got %d!", flag.NArg())
+	}
+	source, err := os.ReadFile(flag.Arg(0))
+	if err != nil {
+		return err
+	}
+	program, err := load(source, nil)
+	if err != nil {
+		return err
+	}
+	if *stripFlag {
+		program.Positions = nil
+	}
+	data, err := bytecode.Encode(program)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(output, data, 0o644)
+}
+
+func display(vm *interpreter.VM) {
+	if *notationFlag == "postfix" {
+		fmt.Println(vm.StackString())
+	} else {
+		fmt.Println(vm)
+	}
+}
+
 func main() {
-	lexerFlag := flag.Bool("l", false, "Display lexer output")
-	parserFlag := flag.Bool("p", false, "Display parser output")
-	generatorFlag := flag.Bool("g", false, "Display generated bytecodes")
 	flag.Parse()
 
-	vm := interpreter.NewVM()
-	scanner := bufio.NewScanner(os.Stdin)
+	if *notationFlag != "prefix" && *notationFlag != "infix" && *notationFlag != "postfix" {
+		fmt.Printf("Unknown notation: %s\n", *notationFlag)
+		os.Exit(2)
+	}
 
-	for {
-		fmt.Print("@> ")
-		scanner.Scan()
-		input := scanner.Text()
-		if input == "" {
-			continue
-		}
+	opts, err := options(*modeFlag)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	vm := interpreter.NewVM(opts...)
+	vm.MaxDepth = *depthFlag
+	vm.Decimals = *decimalsFlag
 
-		l, err := parser.NewLexer(input)
-		if err != nil {
+	if *outputFlag != "" {
+		if err := compileFile(*outputFlag); err != nil {
 			fmt.Println(err)
-			continue
-		}
-		if *lexerFlag {
-			fmt.Println("Tokenizing input...")
-			fmt.Println(l)
+			os.Exit(1)
 		}
+		return
+	}
 
-		p, err := parser.NewParser(l.Tokens)
-		if err != nil {
-			fmt.Println(err)
-			continue
-		}
-		if *parserFlag {
-			fmt.Println("Analyzing syntax...")
-			fmt.Println(p)
+	if flag.NArg() > 0 {
+		for _, path := range flag.Args() {
+			source, err := os.ReadFile(path)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			} else if err := evaluate(vm, source); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
 		}
+		display(vm)
+		return
+	}
 
-		g := parser.NewBytecodeGenerator(p.Nodes)
-		if *generatorFlag {
-			fmt.Println("Compiling instructions...")
-			fmt.Println(g)
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print("@> ")
+		if !scanner.Scan() {
+			fmt.Println()
+			return
+		}
+		input := scanner.Text()
+		if input == "" {
+			continue
 		}
 
-		vm.Execute(g.Bytecode)
-		if err != nil {
+		if err := evaluate(vm, []byte(input)); err != nil {
 			fmt.Println(err)
 			continue
 		}
-		fmt.Println(vm)
+		display(vm)
 	}
 }
@@ -0,0 +1,287 @@
+package bytecode
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The function body an instruction is in, which is the whole program at the
+// top level. Jump targets are relative to its start and may go up to its end.
+type span struct {
+	start, end, depth int
+}
+
+// Function bodies are inline, so the body of an instruction is the innermost
+// one around it.
+func spans(code []Instruction) []span {
+	open := []span{{end: len(code)}}
+	var result []span
+	for i, ins := range code {
+		for len(open) > 1 && i >= open[len(open)-1].end {
+			open = open[:len(open)-1]
+		}
+		result = append(result, open[len(open)-1])
+		if layouts[ins.Op] == functionOperands || layouts[ins.Op] == closureOperands {
+			open = append(open, span{start: i + 1, end: i + 1 + ins.Arg, depth: len(open)})
+		}
+	}
+	return result
+}
+
+// A use of a label by a jump or by the size of a function body.
+type labelRef struct {
+	label string
+	index int
+	line  int
+}
+
+type assembler struct {
+	program Program
+	labels  map[string]int
+	jumps   []labelRef
+	sizes   []labelRef
+	line    int
+}
+
+func (a *assembler) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf(format+" at line %d!", append(args, a.line)...)
+}
+
+func (a *assembler) number(operand string) (int, error) {
+	n, err := strconv.Atoi(operand)
+	if err != nil {
+		return 0, a.errorf("Expected a number, got `%s`", operand)
+	}
+	return n, nil
+}
+
+// A target is either a number or a label, which is resolved once all labels
+// are known.
+func (a *assembler) target(operand string, refs *[]labelRef) int {
+	if n, err := strconv.Atoi(operand); err == nil {
+		return n
+	}
+	*refs = append(*refs, labelRef{label: operand, index: len(a.program.Code), line: a.line})
+	return 0
+}
+
+// Constants are listed as `CONST <index> <literal>`, the way `-g` shows them,
+// or just as `CONST <literal>`.
+func (a *assembler) constant(operands []string) error {
+	if len(operands) == 2 {
+		if index, err := a.number(operands[0]); err != nil {
+			return err
+		} else if index != len(a.program.Constants) {
+			return a.errorf("Expected constant %d, got %d", len(a.program.Constants), index)
+		}
+		operands = operands[1:]
+	}
+	if len(operands) != 1 {
+		return a.errorf("Expected a number literal after `CONST`")
+	}
+	c, err := ParseConstant(operands[0])
+	if err != nil {
+		return a.errorf("%v", err)
+	}
+	a.program.Constants = append(a.program.Constants, c)
+	return nil
+}
+
+// A global is written as its slot and name, or as its name alone to give it
+// the slot it already has or the next free one.
+func (a *assembler) global(ins *Instruction, operands []string) error {
+	if len(operands) == 1 {
+		ins.Name, ins.Arg = operands[0], len(a.program.Symbols)
+		for slot, name := range a.program.Symbols {
+			if name == ins.Name {
+				ins.Arg = slot
+			}
+		}
+	} else if len(operands) == 2 {
+		slot, err := a.number(operands[0])
+		if err != nil {
+			return err
+		}
+		ins.Name, ins.Arg = operands[1], slot
+	} else {
+		return a.errorf("Expected a slot and a name after `%s`", ins.Op)
+	}
+
+	if ins.Arg < 0 {
+		return a.errorf("Invalid global slot %d", ins.Arg)
+	}
+	for len(a.program.Symbols) <= ins.Arg {
+		a.program.Symbols = append(a.program.Symbols, "")
+	}
+	if name := a.program.Symbols[ins.Arg]; name != "" && name != ins.Name {
+		return a.errorf("Global slot %d is both `%s` and `%s`", ins.Arg, name, ins.Name)
+	}
+	a.program.Symbols[ins.Arg] = ins.Name
+	return nil
+}
+
+// The operands are read in the order Instruction.String writes them.
+func (a *assembler) operands(ins *Instruction, operands []string) error {
+	var want int
+	switch layouts[ins.Op] {
+	case nameOperand, operatorOperand, argOperand, constOperand, scopeOperand, boolOperand:
+		want = 1
+	case callOperands:
+		want = 2
+	case globalOperand:
+		return a.global(ins, operands)
+	case localOperands:
+		if len(operands) == 3 {
+			ins.Name, operands = operands[2], operands[:2]
+		}
+		want = 2
+	case functionOperands:
+		if len(operands) < 2 {
+			return a.errorf("Expected a name and a body size after `%s`", ins.Op)
+		}
+		ins.Name, ins.Arg, ins.Params = operands[0], a.target(operands[1], &a.sizes), operands[2:]
+		return nil
+	case closureOperands:
+		if len(operands) < 1 {
+			return a.errorf("Expected a body size after `%s`", ins.Op)
+		}
+		ins.Arg, ins.Params = a.target(operands[0], &a.sizes), operands[1:]
+		return nil
+	}
+	if len(operands) != want {
+		return a.errorf("Expected %d operands for `%s`, got %d", want, ins.Op, len(operands))
+	}
+
+	var err error
+	switch layouts[ins.Op] {
+	case nameOperand:
+		ins.Name = operands[0]
+	case operatorOperand:
+		operator, ok := LookupOperator(operands[0])
+		if !ok {
+			return a.errorf("Unknown operator `%s`", operands[0])
+		}
+		ins.Operator = operator
+	case argOperand:
+		ins.Arg = a.target(operands[0], &a.jumps)
+	case constOperand:
+		ins.Arg, err = a.number(operands[0])
+	case scopeOperand:
+		if ins.Arg, err = a.number(operands[0]); err == nil && (ins.Arg < 0 || ins.Arg > maxScopeSize) {
+			return a.errorf("Invalid scope size %d", ins.Arg)
+		}
+	case boolOperand:
+		value, parseErr := strconv.ParseBool(operands[0])
+		if parseErr != nil {
+			return a.errorf("Expected `true` or `false`, got `%s`", operands[0])
+		} else if value {
+			ins.Arg = 1
+		}
+	case callOperands:
+		ins.Name = operands[0]
+		if ins.Arg, err = a.number(operands[1]); err == nil && (ins.Arg < 0 || ins.Arg > maxArguments) {
+			return a.errorf("Invalid argument count %d", ins.Arg)
+		}
+	case localOperands:
+		if ins.Depth, err = a.number(operands[0]); err == nil {
+			ins.Arg, err = a.number(operands[1])
+		}
+	}
+	return err
+}
+
+func (a *assembler) assembleLine(line string) error {
+	if i := strings.IndexRune(line, '#'); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(line)
+	if len(fields) > 0 && strings.HasSuffix(fields[0], ":") {
+		label := strings.TrimSuffix(fields[0], ":")
+		if _, ok := a.labels[label]; ok {
+			return a.errorf("Label `%s` is defined twice", label)
+		}
+		a.labels[label] = len(a.program.Code)
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return nil
+	} else if fields[0] == "CONST" {
+		return a.constant(fields[1:])
+	}
+
+	op, ok := LookupOpcode(fields[0])
+	if !ok {
+		return a.errorf("Unknown opcode `%s`", fields[0])
+	}
+	ins := Instruction{Op: op}
+	if err := a.operands(&ins, fields[1:]); err != nil {
+		return err
+	}
+	a.program.Code = append(a.program.Code, ins)
+	return nil
+}
+
+func (a *assembler) label(ref labelRef) (int, error) {
+	a.line = ref.line
+	offset, ok := a.labels[ref.label]
+	if !ok {
+		return 0, a.errorf("Undefined label `%s`", ref.label)
+	}
+	return offset, nil
+}
+
+// The sizes of function bodies are resolved first, since the body a jump is
+// in decides what its target is relative to.
+func (a *assembler) resolveLabels() error {
+	for _, ref := range a.sizes {
+		offset, err := a.label(ref)
+		if err != nil {
+			return err
+		}
+		a.program.Code[ref.index].Arg = offset - ref.index - 1
+	}
+
+	spans := spans(a.program.Code)
+	for _, ref := range a.jumps {
+		offset, err := a.label(ref)
+		if err != nil {
+			return err
+		}
+		body := spans[ref.index]
+		if offset < body.start || offset > body.end {
+			return a.errorf("Label `%s` is outside the function of its jump", ref.label)
+		}
+		a.program.Code[ref.index].Arg = offset - body.start
+	}
+	return nil
+}
+
+// Assemble reads a bytecode listing like the one `-g` shows. Each line holds
+// an instruction with its operands separated by whitespace, or a `CONST` of
+// the constant pool, and may start with a `label:` and end with a `#`
+// comment. Jumps and the sizes of function bodies can name a label instead of
+// a number: a jump goes to the instruction after the label, and a body ends
+// right before it.
+func Assemble(source string) (Program, error) {
+	a := &assembler{labels: map[string]int{}}
+	for i, line := range strings.Split(source, "\n") {
+		a.line = i + 1
+		if err := a.assembleLine(line); err != nil {
+			return Program{}, err
+		}
+	}
+	if err := a.resolveLabels(); err != nil {
+		return Program{}, err
+	}
+
+	for slot, name := range a.program.Symbols {
+		if name == "" {
+			return Program{}, fmt.Errorf("Global slot %d has no name!", slot)
+		}
+	}
+	if err := Validate(a.program); err != nil {
+		return Program{}, err
+	}
+	return a.program, nil
+}
@@ -0,0 +1,113 @@
+package bytecode
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func TestAssembleListing(t *testing.T) {
+	p := sampleProgram()
+	p.Constants[1] = Constant{Kind: REAL, Value: big.NewRat(1, 4), Text: "0.25"}
+
+	got, err := Assemble(p.String())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, p) {
+		t.Errorf("The assembled program differs from its listing! Got `%v`, want `%v`.", got, p)
+	}
+}
+
+func TestAssemble(t *testing.T) {
+	tests := []struct {
+		source string
+		want   Program
+	}{
+		{
+			"# Pushes 2 unless x is zero.\n" +
+				"CONST 2\n" +
+				"LOAD_GLOBAL x\n" +
+				"JUMP_IF_FALSE else\n" +
+				"PUSH_CONST 0  # the constant 2\n" +
+				"JUMP end\n" +
+				"else:\n" +
+				"    LOAD_GLOBAL x\n" +
+				"end:",
+			Program{
+				Constants: []Constant{{Kind: INTEGER, Value: big.NewRat(2, 1), Text: "2"}},
+				Symbols:   []string{"x"},
+				Code: []Instruction{
+					{Op: LOAD_GLOBAL, Name: "x"},
+					{Op: JUMP_IF_FALSE, Arg: 4},
+					{Op: PUSH_CONST},
+					{Op: JUMP, Arg: 5},
+					{Op: LOAD_GLOBAL, Name: "x"},
+				},
+			},
+		},
+		{
+			"MAKE_FUNC f end n\n" +
+				"    LOAD_LOCAL 0 0 n\n" +
+				"    JUMP_IF_TRUE done\n" +
+				"    PUSH_BOOL true\n" +
+				"done: RETURN\n" +
+				"end: STORE_GLOBAL 1 f\n" +
+				"LOAD_GLOBAL 0 y\n" +
+				"LOAD_GLOBAL f\n" +
+				"CALL_FUNC f 1",
+			Program{
+				Symbols: []string{"y", "f"},
+				Code: []Instruction{
+					{Op: MAKE_FUNC, Name: "f", Arg: 4, Params: []string{"n"}},
+					{Op: LOAD_LOCAL, Name: "n"},
+					{Op: JUMP_IF_TRUE, Arg: 3},
+					{Op: PUSH_BOOL, Arg: 1},
+					{Op: RETURN},
+					{Op: STORE_GLOBAL, Name: "f", Arg: 1},
+					{Op: LOAD_GLOBAL, Name: "y"},
+					{Op: LOAD_GLOBAL, Name: "f", Arg: 1},
+					{Op: CALL_FUNC, Name: "f", Arg: 1},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := Assemble(tt.source)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Expected `%v`, got `%v`!", tt.want, got)
+		}
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"PUSH_CONST 0\nPOP", "Unknown opcode `POP` at line 2!"},
+		{"CONST 1 2", "Expected constant 0, got 1 at line 1!"},
+		{"CONST 0x", "Invalid number: 0x at line 1!"},
+		{"PUSH_BOOL yes", "Expected `true` or `false`, got `yes` at line 1!"},
+		{"BINARY_OP ADD MUL", "Expected 1 operands for `BINARY_OP`, got 2 at line 1!"},
+		{"COMPARE LESS", "Unknown operator `LESS` at line 1!"},
+		{"LOAD_GLOBAL 0 x\nLOAD_GLOBAL 0 y", "Global slot 0 is both `x` and `y` at line 2!"},
+		{"LOAD_GLOBAL 1 x", "Global slot 0 has no name!"},
+		{"a: DUP\na: DROP", "Label `a` is defined twice at line 2!"},
+		{"JUMP nowhere", "Undefined label `nowhere` at line 1!"},
+		{"MAKE_CLOSURE end\nJUMP out\nend: RETURN\nout:", "Label `out` is outside the function of its jump at line 2!"},
+		{"PUSH_CONST 0", "Invalid constant 0 at instruction 0!"},
+		{"PUSH_SCOPE 99999999999999", "Invalid scope size 99999999999999 at line 1!"},
+		{"CONST 1\nPUSH_CONST 0\nLOAD_GLOBAL min\nCALL_FUNC min 9223372036854775807", "Invalid argument count 9223372036854775807 at line 4!"},
+	}
+
+	for _, tt := range tests {
+		if _, err := Assemble(tt.source); err == nil || err.Error() != tt.want {
+			t.Errorf("Expected `%s`, got `%v`!", tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,384 @@
+package bytecode
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Opcode int
+
+const (
+	// Values and variables
+	PUSH_CONST Opcode = iota
+	PUSH_BOOL
+	LOAD_GLOBAL
+	STORE_GLOBAL
+	STORE_CONST
+	LOAD_LOCAL
+	STORE_LOCAL
+	PUSH_SCOPE
+	POP_SCOPE
+
+	// Functions
+	MAKE_FUNC
+	MAKE_CLOSURE
+	CALL_FUNC
+	TAIL_CALL
+	RETURN
+
+	// Control flow
+	JUMP
+	JUMP_IF_FALSE
+	JUMP_IF_TRUE
+
+	// Operations
+	UNARY_OP
+	BINARY_OP
+	COMPARE
+	BITWISE_OP
+	APPLY_UNIT
+	CONVERT
+
+	// Stack words
+	DUP
+	SWAP
+	DROP
+	OVER
+	CLEAR
+)
+
+var opcodeNames = map[Opcode]string{
+	PUSH_CONST:    "PUSH_CONST",
+	PUSH_BOOL:     "PUSH_BOOL",
+	LOAD_GLOBAL:   "LOAD_GLOBAL",
+	STORE_GLOBAL:  "STORE_GLOBAL",
+	STORE_CONST:   "STORE_CONST",
+	LOAD_LOCAL:    "LOAD_LOCAL",
+	STORE_LOCAL:   "STORE_LOCAL",
+	PUSH_SCOPE:    "PUSH_SCOPE",
+	POP_SCOPE:     "POP_SCOPE",
+	MAKE_FUNC:     "MAKE_FUNC",
+	MAKE_CLOSURE:  "MAKE_CLOSURE",
+	CALL_FUNC:     "CALL_FUNC",
+	TAIL_CALL:     "TAIL_CALL",
+	RETURN:        "RETURN",
+	JUMP:          "JUMP",
+	JUMP_IF_FALSE: "JUMP_IF_FALSE",
+	JUMP_IF_TRUE:  "JUMP_IF_TRUE",
+	UNARY_OP:      "UNARY_OP",
+	BINARY_OP:     "BINARY_OP",
+	COMPARE:       "COMPARE",
+	BITWISE_OP:    "BITWISE_OP",
+	APPLY_UNIT:    "APPLY_UNIT",
+	CONVERT:       "CONVERT",
+	DUP:           "DUP",
+	SWAP:          "SWAP",
+	DROP:          "DROP",
+	OVER:          "OVER",
+	CLEAR:         "CLEAR",
+}
+
+func (op Opcode) String() string {
+	if name, ok := opcodeNames[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("OPCODE(%d)", int(op))
+}
+
+func LookupOpcode(name string) (Opcode, bool) {
+	for op, opName := range opcodeNames {
+		if name == opName {
+			return op, true
+		}
+	}
+	return 0, false
+}
+
+// Operators are the operands of UNARY_OP, BINARY_OP, COMPARE and BITWISE_OP.
+// The zero value is no operator at all.
+type Operator int
+
+const (
+	ADD Operator = iota + 1
+	SUB
+	MUL
+	DIV
+	IDIV
+	MOD
+	POW
+	FACT
+	NOT
+	SQRT
+	LT
+	LE
+	GT
+	GE
+	EQ
+	NE
+	BAND
+	BOR
+	BXOR
+	BNOT
+	SHL
+	SHR
+)
+
+var operatorNames = map[Operator]string{
+	ADD:  "ADD",
+	SUB:  "SUB",
+	MUL:  "MUL",
+	DIV:  "DIV",
+	IDIV: "IDIV",
+	MOD:  "MOD",
+	POW:  "POW",
+	FACT: "FACT",
+	NOT:  "NOT",
+	SQRT: "SQRT",
+	LT:   "LT",
+	LE:   "LE",
+	GT:   "GT",
+	GE:   "GE",
+	EQ:   "EQ",
+	NE:   "NE",
+	BAND: "BAND",
+	BOR:  "BOR",
+	BXOR: "BXOR",
+	BNOT: "BNOT",
+	SHL:  "SHL",
+	SHR:  "SHR",
+}
+
+func (op Operator) String() string {
+	if name, ok := operatorNames[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("OPERATOR(%d)", int(op))
+}
+
+func LookupOperator(name string) (Operator, bool) {
+	for op, opName := range operatorNames {
+		if name == opName {
+			return op, true
+		}
+	}
+	return 0, false
+}
+
+// The operands an opcode takes, in the order they are written.
+type layout int
+
+const (
+	noOperands layout = iota
+	nameOperand
+	operatorOperand
+	argOperand
+	constOperand
+	globalOperand
+	localOperands
+	scopeOperand
+	boolOperand
+	callOperands
+	functionOperands
+	closureOperands
+)
+
+var layouts = map[Opcode]layout{
+	PUSH_CONST:    constOperand,
+	PUSH_BOOL:     boolOperand,
+	LOAD_GLOBAL:   globalOperand,
+	STORE_GLOBAL:  globalOperand,
+	STORE_CONST:   globalOperand,
+	LOAD_LOCAL:    localOperands,
+	STORE_LOCAL:   localOperands,
+	PUSH_SCOPE:    scopeOperand,
+	MAKE_FUNC:     functionOperands,
+	MAKE_CLOSURE:  closureOperands,
+	CALL_FUNC:     callOperands,
+	TAIL_CALL:     callOperands,
+	JUMP:          argOperand,
+	JUMP_IF_FALSE: argOperand,
+	JUMP_IF_TRUE:  argOperand,
+	UNARY_OP:      operatorOperand,
+	BINARY_OP:     operatorOperand,
+	COMPARE:       operatorOperand,
+	BITWISE_OP:    operatorOperand,
+	APPLY_UNIT:    nameOperand,
+}
+
+var operators = map[Opcode][]Operator{
+	UNARY_OP:   {ADD, SUB, FACT, NOT, SQRT},
+	BINARY_OP:  {ADD, SUB, MUL, DIV, IDIV, MOD, POW},
+	COMPARE:    {LT, LE, GT, GE, EQ, NE},
+	BITWISE_OP: {BAND, BOR, BXOR, BNOT, SHL, SHR},
+}
+
+// The meaning of the operands depends on the opcode: Name is a function or a
+// unit, Operator is the operation of UNARY_OP, BINARY_OP, COMPARE and
+// BITWISE_OP, Arg is the index of a constant, a slot, the size of a
+// scope, an argument count, the size of a function body, a jump target or a
+// boolean, Depth is how many scopes up a local lives, and Params are the
+// parameters of a function. Variables are addressed by their slots alone and
+// only keep their names for the output of `-g` and error messages.
+type Instruction struct {
+	Op       Opcode
+	Operator Operator
+	Name     string
+	Arg      int
+	Depth    int
+	Params   []string
+}
+
+func (ins Instruction) Bool() bool {
+	return ins.Arg != 0
+}
+
+func (ins Instruction) operands() []string {
+	arg := strconv.Itoa(ins.Arg)
+	switch layouts[ins.Op] {
+	case nameOperand:
+		return []string{ins.Name}
+	case operatorOperand:
+		return []string{ins.Operator.String()}
+	case argOperand, constOperand, scopeOperand:
+		return []string{arg}
+	case globalOperand:
+		return withName([]string{arg}, ins.Name)
+	case localOperands:
+		return withName([]string{strconv.Itoa(ins.Depth), arg}, ins.Name)
+	case boolOperand:
+		return []string{strconv.FormatBool(ins.Bool())}
+	case callOperands:
+		return []string{ins.Name, arg}
+	case functionOperands:
+		return append([]string{ins.Name, arg}, ins.Params...)
+	case closureOperands:
+		return append([]string{arg}, ins.Params...)
+	}
+	return nil
+}
+
+func withName(operands []string, name string) []string {
+	if name == "" {
+		return operands
+	}
+	return append(operands, name)
+}
+
+func (ins Instruction) String() string {
+	return strings.Join(append([]string{ins.Op.String()}, ins.operands()...), "\t")
+}
+
+type Position struct {
+	Line, Column int
+}
+
+// A program is compiled code together with the pool of constants that its
+// PUSH_CONST instructions refer to by index and the names of the global slots
+// it uses. Function bodies share the pool and slots of the program they are
+// part of. Positions are debug information, the place in the source each
+// instruction was compiled from, and may be left out.
+type Program struct {
+	Constants []Constant
+	Symbols   []string
+	Code      []Instruction
+	Positions []Position
+}
+
+func (p Program) String() string {
+	var lines []string
+	for i, c := range p.Constants {
+		lines = append(lines, fmt.Sprintf("CONST\t%d\t%s", i, c))
+	}
+	for _, ins := range p.Code {
+		lines = append(lines, ins.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// No compiled program comes close to these, while bigger operands would only
+// make the VM allocate until it runs out of memory.
+const (
+	maxScopeSize = 1 << 16
+	maxArguments = 1 << 16
+)
+
+// Jump targets are relative to the function body they appear in, and a body
+// follows its MAKE_FUNC or MAKE_CLOSURE directly, so each body is checked on
+// its own.
+func Validate(p Program) error {
+	for _, c := range p.Constants {
+		if c.Value == nil {
+			return fmt.Errorf("Invalid number: %s", c.Text)
+		}
+	}
+	if p.Positions != nil && len(p.Positions) != len(p.Code) {
+		return fmt.Errorf("Expected a position for each of the %d instructions, got %d!", len(p.Code), len(p.Positions))
+	}
+	return validate(p, p.Code, 0)
+}
+
+// Errors count instructions from the start of the whole program, even inside
+// a function body.
+func validate(p Program, code []Instruction, offset int) error {
+	for i := 0; i < len(code); i++ {
+		ins := code[i]
+		if _, ok := opcodeNames[ins.Op]; !ok {
+			return fmt.Errorf("Unknown opcode %d at instruction %d!", int(ins.Op), offset+i)
+		}
+
+		switch layouts[ins.Op] {
+		case nameOperand, callOperands, functionOperands:
+			if ins.Name == "" {
+				return fmt.Errorf("Missing operand of `%s` at instruction %d!", ins.Op, offset+i)
+			}
+		}
+		if valid, ok := operators[ins.Op]; ok && !contains(valid, ins.Operator) {
+			return fmt.Errorf("Unknown operator `%s` for `%s` at instruction %d!", ins.Operator, ins.Op, offset+i)
+		}
+
+		switch layouts[ins.Op] {
+		case constOperand:
+			if ins.Arg < 0 || ins.Arg >= len(p.Constants) {
+				return fmt.Errorf("Invalid constant %d at instruction %d!", ins.Arg, offset+i)
+			}
+		case globalOperand:
+			if ins.Arg < 0 || ins.Arg >= len(p.Symbols) {
+				return fmt.Errorf("Invalid global slot %d at instruction %d!", ins.Arg, offset+i)
+			}
+		case localOperands:
+			if ins.Depth < 0 || ins.Arg < 0 {
+				return fmt.Errorf("Invalid local slot %d at depth %d at instruction %d!", ins.Arg, ins.Depth, offset+i)
+			}
+		case scopeOperand:
+			if ins.Arg < 0 || ins.Arg > maxScopeSize {
+				return fmt.Errorf("Invalid scope size %d at instruction %d!", ins.Arg, offset+i)
+			}
+		case argOperand:
+			if ins.Arg < 0 || ins.Arg > len(code) {
+				return fmt.Errorf("Invalid jump target %d at instruction %d!", ins.Arg, offset+i)
+			}
+		case callOperands:
+			if ins.Arg < 0 || ins.Arg > maxArguments {
+				return fmt.Errorf("Invalid argument count %d at instruction %d!", ins.Arg, offset+i)
+			}
+		case functionOperands, closureOperands:
+			if ins.Arg < 0 || i+1+ins.Arg > len(code) {
+				return fmt.Errorf("Function body of size %d at instruction %d exceeds the bytecode!", ins.Arg, offset+i)
+			} else if err := validate(p, code[i+1:i+1+ins.Arg], offset+i+1); err != nil {
+				return err
+			}
+			i += ins.Arg
+		}
+	}
+	return nil
+}
+
+func contains(operators []Operator, operator Operator) bool {
+	for _, op := range operators {
+		if op == operator {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,195 @@
+package bytecode
+
+import (
+	"math"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func TestInstructionString(t *testing.T) {
+	tests := []struct {
+		ins  Instruction
+		want string
+	}{
+		{Instruction{Op: PUSH_CONST, Arg: 3}, "PUSH_CONST\t3"},
+		{Instruction{Op: PUSH_BOOL, Arg: 1}, "PUSH_BOOL\ttrue"},
+		{Instruction{Op: COMPARE, Operator: LE}, "COMPARE\tLE"},
+		{Instruction{Op: LOAD_GLOBAL, Name: "x", Arg: 2}, "LOAD_GLOBAL\t2\tx"},
+		{Instruction{Op: LOAD_LOCAL, Name: "n", Arg: 1, Depth: 2}, "LOAD_LOCAL\t2\t1\tn"},
+		{Instruction{Op: STORE_LOCAL, Arg: 0}, "STORE_LOCAL\t0\t0"},
+		{Instruction{Op: PUSH_SCOPE, Arg: 2}, "PUSH_SCOPE\t2"},
+		{Instruction{Op: PUSH_BOOL}, "PUSH_BOOL\tfalse"},
+		{Instruction{Op: CALL_FUNC, Name: "max", Arg: 2}, "CALL_FUNC\tmax\t2"},
+		{Instruction{Op: MAKE_FUNC, Name: "f", Arg: 4, Params: []string{"a", "b"}}, "MAKE_FUNC\tf\t4\ta\tb"},
+		{Instruction{Op: MAKE_CLOSURE, Arg: 2, Params: []string{"x"}}, "MAKE_CLOSURE\t2\tx"},
+		{Instruction{Op: JUMP_IF_FALSE, Arg: 7}, "JUMP_IF_FALSE\t7"},
+		{Instruction{Op: RETURN}, "RETURN"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.ins.String(); got != tt.want {
+			t.Errorf("Expected `%s`, got `%s`!", tt.want, got)
+		}
+	}
+}
+
+func TestLookupOpcode(t *testing.T) {
+	for op, name := range opcodeNames {
+		if got, ok := LookupOpcode(name); !ok || got != op {
+			t.Errorf("Expected `%s` to name opcode %d, got %d!", name, op, got)
+		}
+	}
+	if _, ok := LookupOpcode("NOP"); ok {
+		t.Errorf("Expected `NOP` to be unknown!")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := Program{
+		Constants: []Constant{{Kind: INTEGER, Value: big.NewRat(1, 1), Text: "1"}},
+		Symbols:   []string{"f"},
+		Code: []Instruction{
+			{Op: MAKE_FUNC, Name: "f", Arg: 3, Params: []string{"n"}},
+			{Op: LOAD_LOCAL, Name: "n"},
+			{Op: JUMP, Arg: 2},
+			{Op: RETURN},
+			{Op: STORE_GLOBAL, Name: "f"},
+			{Op: PUSH_CONST, Arg: 0},
+			{Op: LOAD_GLOBAL, Name: "f"},
+			{Op: CALL_FUNC, Name: "f", Arg: 1},
+		},
+	}
+	if err := Validate(valid); err != nil {
+		t.Errorf("Expected valid bytecode, got `%v`!", err)
+	}
+
+	tests := []struct {
+		code []Instruction
+		want string
+	}{
+		{[]Instruction{{Op: Opcode(99)}}, "Unknown opcode 99 at instruction 0!"},
+		{[]Instruction{{Op: RETURN}, {Op: APPLY_UNIT}}, "Missing operand of `APPLY_UNIT` at instruction 1!"},
+		{[]Instruction{{Op: BINARY_OP, Operator: LT}}, "Unknown operator `LT` for `BINARY_OP` at instruction 0!"},
+		{[]Instruction{{Op: UNARY_OP}}, "Unknown operator `OPERATOR(0)` for `UNARY_OP` at instruction 0!"},
+		{[]Instruction{{Op: JUMP, Arg: 2}}, "Invalid jump target 2 at instruction 0!"},
+		{[]Instruction{{Op: CALL_FUNC, Name: "f", Arg: -1}}, "Invalid argument count -1 at instruction 0!"},
+		{
+			[]Instruction{{Op: CALL_FUNC, Name: "min", Arg: math.MaxInt64}},
+			"Invalid argument count 9223372036854775807 at instruction 0!",
+		},
+		{[]Instruction{{Op: PUSH_SCOPE, Arg: 99999999999999}}, "Invalid scope size 99999999999999 at instruction 0!"},
+		{
+			[]Instruction{{Op: MAKE_CLOSURE, Arg: 2}, {Op: RETURN}},
+			"Function body of size 2 at instruction 0 exceeds the bytecode!",
+		},
+		{
+			[]Instruction{{Op: PUSH_SCOPE}, {Op: MAKE_CLOSURE, Arg: 2}, {Op: JUMP, Arg: 3}, {Op: RETURN}, {Op: JUMP, Arg: 5}},
+			"Invalid jump target 3 at instruction 2!",
+		},
+		{[]Instruction{{Op: PUSH_CONST, Arg: 0}}, "Invalid constant 0 at instruction 0!"},
+		{
+			[]Instruction{{Op: MAKE_CLOSURE, Arg: 2}, {Op: PUSH_CONST, Arg: -1}, {Op: RETURN}},
+			"Invalid constant -1 at instruction 1!",
+		},
+		{[]Instruction{{Op: LOAD_GLOBAL, Arg: 0}}, "Invalid global slot 0 at instruction 0!"},
+		{[]Instruction{{Op: STORE_LOCAL, Depth: -1}}, "Invalid local slot 0 at depth -1 at instruction 0!"},
+		{[]Instruction{{Op: PUSH_SCOPE, Arg: -2}}, "Invalid scope size -2 at instruction 0!"},
+	}
+
+	for _, tt := range tests {
+		if err := Validate(Program{Code: tt.code}); err == nil || err.Error() != tt.want {
+			t.Errorf("Expected `%s`, got `%v`!", tt.want, err)
+		}
+	}
+}
+
+func TestValidateConstants(t *testing.T) {
+	p := Program{Constants: []Constant{{Text: "1e"}}, Code: []Instruction{{Op: PUSH_CONST, Arg: 0}}}
+	if err := Validate(p); err == nil || err.Error() != "Invalid number: 1e" {
+		t.Errorf("Expected `Invalid number: 1e`, got `%v`!", err)
+	}
+}
+
+func TestParseConstant(t *testing.T) {
+	tests := []struct {
+		text   string
+		kind   ConstantKind
+		value  string
+		places int
+	}{
+		{"42", INTEGER, "42", 0},
+		{"1_000_000", INTEGER, "1000000", 0},
+		{"0xff", INTEGER, "255", 0},
+		{"0b1010", INTEGER, "10", 0},
+		{"0o17", INTEGER, "15", 0},
+		{"3.14", REAL, "157/50", 2},
+		{"2.0", REAL, "2", 1},
+		{"1.5e3", REAL, "1500", 0},
+		{"25e-2", REAL, "1/4", 2},
+		{"2i", IMAGINARY, "2", 0},
+		{"0.5i", IMAGINARY, "1/2", 1},
+		{"0xe1", INTEGER, "225", 0},
+		{"1_000.25e-1", REAL, "4001/40", 3},
+	}
+
+	for _, tt := range tests {
+		c, err := ParseConstant(tt.text)
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+			continue
+		}
+		if c.Kind != tt.kind || c.Value.RatString() != tt.value || c.Text != tt.text {
+			t.Errorf("Expected %s %s for `%s`, got %s %s!", tt.kind, tt.value, tt.text, c.Kind, c.Value.RatString())
+		}
+		if c.Places() != tt.places {
+			t.Errorf("Expected %d places for `%s`, got %d!", tt.places, tt.text, c.Places())
+		}
+	}
+
+	for _, text := range []string{"0x", "1e", "1e999999", "1..2"} {
+		if _, err := ParseConstant(text); err == nil {
+			t.Errorf("Expected an error for `%s`!", text)
+		}
+	}
+}
+
+func TestConstantPool(t *testing.T) {
+	var pool ConstantPool
+	var indices []int
+	for _, text := range []string{"1000", "2", "1_000", "2.0", "0x3e8", "2"} {
+		c, err := ParseConstant(text)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		indices = append(indices, pool.Add(c))
+	}
+
+	if want := []int{0, 1, 0, 2, 0, 1}; !reflect.DeepEqual(indices, want) {
+		t.Errorf("Expected indices %v, got %v!", want, indices)
+	}
+	if len(pool.Constants) != 3 {
+		t.Errorf("Expected 3 constants, got %d!", len(pool.Constants))
+	}
+}
+
+func TestSymbolTable(t *testing.T) {
+	var table SymbolTable
+	var slots []int
+	for _, name := range []string{"x", "f", "x", "y", "f"} {
+		slots = append(slots, table.Add(name))
+	}
+
+	if want := []int{0, 1, 0, 2, 1}; !reflect.DeepEqual(slots, want) {
+		t.Errorf("Expected slots %v, got %v!", want, slots)
+	}
+	if want := []string{"x", "f", "y"}; !reflect.DeepEqual(table.Names, want) {
+		t.Errorf("Expected names %v, got %v!", want, table.Names)
+	}
+	if slot, ok := table.Lookup("y"); !ok || slot != 2 {
+		t.Errorf("Expected `y` in slot 2, got %d!", slot)
+	}
+	if _, ok := table.Lookup("z"); ok {
+		t.Errorf("Expected `z` to be unknown!")
+	}
+}
@@ -0,0 +1,126 @@
+package bytecode
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+type ConstantKind int
+
+const (
+	INTEGER ConstantKind = iota
+	REAL
+	IMAGINARY
+)
+
+var constantKindNames = map[ConstantKind]string{
+	INTEGER:   "INTEGER",
+	REAL:      "REAL",
+	IMAGINARY: "IMAGINARY",
+}
+
+func (k ConstantKind) String() string {
+	return constantKindNames[k]
+}
+
+// Literals with exponents beyond this are rejected rather than expanded into
+// enormous exact fractions.
+const maxExponent = 100000
+
+// A constant is a number literal parsed once into an exact fraction. Its kind
+// remembers how it was written, since `2` and `2.0` only differ in the integer
+// mode, and the value of an imaginary literal is its imaginary part.
+type Constant struct {
+	Kind  ConstantKind
+	Value *big.Rat
+	Text  string
+}
+
+func (c Constant) String() string {
+	return c.Text
+}
+
+// Constants are the same when they are written the same way or have the same
+// kind and value, like `1000` and `1_000`.
+func (c Constant) key() string {
+	if c.Value == nil {
+		return c.Text
+	}
+	return fmt.Sprintf("%s %s", c.Kind, c.Value.RatString())
+}
+
+type ConstantPool struct {
+	Constants []Constant
+	indices   map[string]int
+}
+
+// Add returns the index of the constant, adding it only when the pool does not
+// hold an equal one yet.
+func (p *ConstantPool) Add(c Constant) int {
+	if p.indices == nil {
+		p.indices = map[string]int{}
+	}
+	if i, ok := p.indices[c.key()]; ok {
+		return i
+	}
+	p.indices[c.key()] = len(p.Constants)
+	p.Constants = append(p.Constants, c)
+	return len(p.Constants) - 1
+}
+
+// Places are the decimal places a literal is written with, counting its
+// exponent, like 3 for `2.345` and 9 for `1e-9`.
+func (c Constant) Places() int {
+	digits := strings.ToLower(strings.ReplaceAll(c.Text, "_", ""))
+	exponent := 0
+	if i := strings.IndexRune(digits, 'e'); i >= 0 && c.Kind != INTEGER {
+		exponent, _ = strconv.Atoi(strings.TrimSuffix(digits[i+1:], "i"))
+		digits = digits[:i]
+	}
+	places := -exponent
+	if i := strings.IndexRune(digits, '.'); i >= 0 {
+		places += len(strings.TrimSuffix(digits[i+1:], "i"))
+	}
+	if places < 0 {
+		return 0
+	}
+	return places
+}
+
+// ParseConstant reads a number literal as the lexer accepts it, including
+// digit separators and an imaginary suffix.
+func ParseConstant(text string) (Constant, error) {
+	c := Constant{Kind: INTEGER, Text: text}
+	digits := strings.ReplaceAll(text, "_", "")
+	if strings.HasSuffix(digits, "i") {
+		c.Kind = IMAGINARY
+		digits = strings.TrimSuffix(digits, "i")
+	}
+
+	unsigned := strings.TrimLeft(digits, "+-")
+	if len(unsigned) > 1 && unsigned[0] == '0' && strings.ContainsRune("xXbBoO", rune(unsigned[1])) {
+		// Hexadecimal, binary and octal literals are always whole numbers.
+		if i, ok := new(big.Int).SetString(digits, 0); ok {
+			c.Value = new(big.Rat).SetInt(i)
+			return c, nil
+		}
+		return Constant{}, fmt.Errorf("Invalid number: %s", text)
+	} else if strings.ContainsAny(unsigned, ".eE") && c.Kind == INTEGER {
+		c.Kind = REAL
+	}
+
+	if i := strings.IndexAny(unsigned, "eE"); i >= 0 {
+		exponent, err := strconv.Atoi(unsigned[i+1:])
+		if err != nil || exponent > maxExponent || exponent < -maxExponent {
+			return Constant{}, fmt.Errorf("Invalid number: %s", text)
+		}
+	}
+	value, ok := new(big.Rat).SetString(digits)
+	if !ok {
+		return Constant{}, fmt.Errorf("Invalid number: %s", text)
+	}
+	c.Value = value
+	return c, nil
+}
@@ -0,0 +1,67 @@
+package bytecode
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+)
+
+// The comment of an instruction spells out what its operand refers to: the
+// value of a constant, the offset a jump goes to, or the offset that follows
+// the body of a function.
+func comment(p Program, ins Instruction, i int, body span) string {
+	switch layouts[ins.Op] {
+	case constOperand:
+		if ins.Arg >= 0 && ins.Arg < len(p.Constants) {
+			return fmt.Sprintf("# %s", p.Constants[ins.Arg])
+		}
+	case argOperand:
+		return fmt.Sprintf("# to %04d", body.start+ins.Arg)
+	case functionOperands, closureOperands:
+		return fmt.Sprintf("# skips to %04d", i+1+ins.Arg)
+	}
+	return ""
+}
+
+// Disassemble renders a program for reading: the constant pool with the kind
+// and exact value of each constant, the global slots, and the instructions
+// with their offsets and source positions. Function bodies are indented under
+// the instruction that creates them.
+func Disassemble(p Program) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(w, "Constants:")
+	for i, c := range p.Constants {
+		value := "?"
+		if c.Value != nil {
+			value = c.Value.RatString()
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", i, c, c.Kind, value)
+	}
+	fmt.Fprintln(w, "Globals:")
+	for slot, name := range p.Symbols {
+		fmt.Fprintf(w, "%d\t%s\n", slot, name)
+	}
+	w.Flush()
+
+	w = tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "Code:")
+	spans := spans(p.Code)
+	for i, ins := range p.Code {
+		pos := "-"
+		if i < len(p.Positions) && p.Positions[i].Line > 0 {
+			pos = fmt.Sprintf("%d:%d", p.Positions[i].Line, p.Positions[i].Column)
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s%s\t%s\t%s\n", i, pos, strings.Repeat("  ", spans[i].depth), ins.Op,
+			strings.Join(ins.operands(), " "), comment(p, ins, i, spans[i]))
+	}
+	w.Flush()
+
+	// Instructions without a comment leave their padding at the end.
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
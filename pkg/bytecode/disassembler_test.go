@@ -0,0 +1,34 @@
+package bytecode
+
+import "testing"
+
+func TestDisassemble(t *testing.T) {
+	p, err := Assemble("CONST 1.5\n" +
+		"LOAD_GLOBAL x\n" +
+		"JUMP_IF_FALSE end\n" +
+		"MAKE_CLOSURE body a\n" +
+		"    LOAD_LOCAL 0 0 a\n" +
+		"    RETURN\n" +
+		"body: PUSH_CONST 0\n" +
+		"end: RETURN")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	p.Positions = []Position{{Line: 1, Column: 1}, {Line: 1, Column: 1}, {Line: 1, Column: 5}, {Line: 1, Column: 5}, {Line: 1, Column: 5}, {Line: 2, Column: 1}, {}}
+
+	want := "Constants:\n" +
+		"0  1.5  REAL  3/2\n" +
+		"Globals:\n" +
+		"0  x\n" +
+		"Code:\n" +
+		"0000  1:1  LOAD_GLOBAL    0 x\n" +
+		"0001  1:1  JUMP_IF_FALSE  6      # to 0006\n" +
+		"0002  1:5  MAKE_CLOSURE   2 a    # skips to 0005\n" +
+		"0003  1:5    LOAD_LOCAL   0 0 a\n" +
+		"0004  1:5    RETURN\n" +
+		"0005  2:1  PUSH_CONST     0      # 1.5\n" +
+		"0006  -    RETURN"
+	if got := Disassemble(p); got != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, got)
+	}
+}
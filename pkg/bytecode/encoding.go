@@ -0,0 +1,243 @@
+package bytecode
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"math/big"
+)
+
+// Every compiled file starts with the magic bytes and the version of its
+// format, and ends with a CRC-32 of everything before the checksum.
+const (
+	Magic   = "\x00BCC"
+	Version = 2
+)
+
+const hasPositions = 1 << 0
+
+// The format is a sequence of sections: a header, the constant pool, the
+// symbol table, the instructions and, when the flags say so, the positions.
+// Counts and operands are varints, strings carry their length in front of
+// them, and constants are stored as exact fractions so that every mode reads
+// them back the way the compiler parsed them.
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) uint(n int) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf.Write(b[:binary.PutUvarint(b[:], uint64(n))])
+}
+
+func (e *encoder) int(n int) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf.Write(b[:binary.PutVarint(b[:], int64(n))])
+}
+
+func (e *encoder) string(s string) {
+	e.uint(len(s))
+	e.buf.WriteString(s)
+}
+
+func (e *encoder) strings(list []string) {
+	e.uint(len(list))
+	for _, s := range list {
+		e.string(s)
+	}
+}
+
+// Positions are stored as runs, since the instructions of a statement share
+// its position.
+func (e *encoder) positions(positions []Position) {
+	var runs [][]int
+	for i, pos := range positions {
+		if i > 0 && pos == positions[i-1] {
+			runs[len(runs)-1][0]++
+			continue
+		}
+		runs = append(runs, []int{1, pos.Line, pos.Column})
+	}
+	e.uint(len(runs))
+	for _, run := range runs {
+		e.uint(run[0])
+		e.uint(run[1])
+		e.uint(run[2])
+	}
+}
+
+// Encode turns a program into the bytes of a compiled file. Its positions are
+// only written when it has them.
+func Encode(p Program) ([]byte, error) {
+	if err := Validate(p); err != nil {
+		return nil, err
+	}
+
+	var e encoder
+	e.buf.WriteString(Magic)
+	e.uint(Version)
+	var flags int
+	if p.Positions != nil {
+		flags |= hasPositions
+	}
+	e.uint(flags)
+
+	e.uint(len(p.Constants))
+	for _, c := range p.Constants {
+		e.uint(int(c.Kind))
+		e.string(c.Value.RatString())
+		e.string(c.Text)
+	}
+	e.strings(p.Symbols)
+	e.uint(len(p.Code))
+	for _, ins := range p.Code {
+		e.uint(int(ins.Op))
+		e.uint(int(ins.Operator))
+		e.string(ins.Name)
+		e.int(ins.Arg)
+		e.int(ins.Depth)
+		e.strings(ins.Params)
+	}
+	if p.Positions != nil {
+		e.positions(p.Positions)
+	}
+
+	return binary.BigEndian.AppendUint32(e.buf.Bytes(), crc32.ChecksumIEEE(e.buf.Bytes())), nil
+}
+
+// The decoder remembers the first error, so that a section can be read to
+// the end and checked once.
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) fail() {
+	if d.err == nil {
+		d.err = fmt.Errorf("Truncated or malformed bytecode!")
+	}
+}
+
+func (d *decoder) uint() int {
+	n, size := binary.Uvarint(d.data)
+	if size <= 0 || n > math.MaxInt32 {
+		d.fail()
+		return 0
+	}
+	d.data = d.data[size:]
+	return int(n)
+}
+
+func (d *decoder) int() int {
+	n, size := binary.Varint(d.data)
+	if size <= 0 {
+		d.fail()
+		return 0
+	}
+	d.data = d.data[size:]
+	return int(n)
+}
+
+// Counts are checked against the bytes that are left before anything is
+// allocated for them, since every element takes at least one byte.
+func (d *decoder) count() int {
+	n := d.uint()
+	if n > len(d.data) {
+		d.fail()
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) string() string {
+	n := d.count()
+	if d.err != nil {
+		return ""
+	}
+	s := string(d.data[:n])
+	d.data = d.data[n:]
+	return s
+}
+
+func (d *decoder) strings() []string {
+	var list []string
+	for n := d.count(); n > 0 && d.err == nil; n-- {
+		list = append(list, d.string())
+	}
+	return list
+}
+
+func (d *decoder) positions(instructions int) []Position {
+	positions := []Position{}
+	for n := d.count(); n > 0 && d.err == nil; n-- {
+		count, pos := d.uint(), Position{Line: d.uint(), Column: d.uint()}
+		if count > instructions-len(positions) {
+			d.fail()
+			break
+		}
+		for ; count > 0; count-- {
+			positions = append(positions, pos)
+		}
+	}
+	return positions
+}
+
+// Decode reads a compiled file back into a program, which is validated
+// before it is returned.
+func Decode(data []byte) (Program, error) {
+	if len(data) < len(Magic)+4 || string(data[:len(Magic)]) != Magic {
+		return Program{}, fmt.Errorf("Not a compiled program!")
+	}
+	body, sum := data[:len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return Program{}, fmt.Errorf("Checksum mismatch! The compiled program is corrupted.")
+	}
+
+	d := decoder{data: body[len(Magic):]}
+	if version := d.uint(); d.err == nil && version != Version {
+		return Program{}, fmt.Errorf("Unsupported bytecode version %d! Expected %d.", version, Version)
+	}
+	flags := d.uint()
+
+	var p Program
+	for n := d.count(); n > 0 && d.err == nil; n-- {
+		kind, value, text := ConstantKind(d.uint()), d.string(), d.string()
+		if d.err != nil {
+			break
+		} else if _, ok := constantKindNames[kind]; !ok {
+			return Program{}, fmt.Errorf("Unknown constant kind %d!", kind)
+		}
+		rat, ok := new(big.Rat).SetString(value)
+		if !ok {
+			return Program{}, fmt.Errorf("Invalid number: %s", text)
+		}
+		p.Constants = append(p.Constants, Constant{Kind: kind, Value: rat, Text: text})
+	}
+	p.Symbols = d.strings()
+	for n := d.count(); n > 0 && d.err == nil; n-- {
+		p.Code = append(p.Code, Instruction{
+			Op:       Opcode(d.uint()),
+			Operator: Operator(d.uint()),
+			Name:     d.string(),
+			Arg:      d.int(),
+			Depth:    d.int(),
+			Params:   d.strings(),
+		})
+	}
+	if flags&hasPositions != 0 {
+		p.Positions = d.positions(len(p.Code))
+	}
+
+	if d.err == nil && len(d.data) > 0 {
+		d.fail()
+	}
+	if d.err != nil {
+		return Program{}, d.err
+	}
+	if err := Validate(p); err != nil {
+		return Program{}, err
+	}
+	return p, nil
+}
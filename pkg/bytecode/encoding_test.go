@@ -0,0 +1,105 @@
+package bytecode
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func sampleProgram() Program {
+	return Program{
+		Constants: []Constant{
+			{Kind: INTEGER, Value: big.NewRat(1000, 1), Text: "1_000"},
+			{Kind: REAL, Value: big.NewRat(-1, 4), Text: "-0.25"},
+			{Kind: IMAGINARY, Value: big.NewRat(2, 1), Text: "2i"},
+		},
+		Symbols: []string{"f", "x"},
+		Code: []Instruction{
+			{Op: MAKE_FUNC, Name: "f", Arg: 4, Params: []string{"a", "b"}},
+			{Op: LOAD_LOCAL, Name: "a"},
+			{Op: LOAD_LOCAL, Name: "b", Arg: 1},
+			{Op: BINARY_OP, Operator: ADD},
+			{Op: RETURN},
+			{Op: STORE_GLOBAL, Name: "f"},
+			{Op: PUSH_CONST, Arg: 0},
+			{Op: PUSH_CONST, Arg: 1},
+			{Op: LOAD_GLOBAL, Name: "f"},
+			{Op: CALL_FUNC, Name: "f", Arg: 2},
+			{Op: STORE_GLOBAL, Name: "x", Arg: 1},
+			{Op: PUSH_BOOL, Arg: 1},
+		},
+	}
+}
+
+// Rewrites the checksum after the bytes were tampered with on purpose.
+func resum(data []byte) []byte {
+	body := data[:len(data)-4]
+	return binary.BigEndian.AppendUint32(append([]byte(nil), body...), crc32.ChecksumIEEE(body))
+}
+
+func TestEncodeDecode(t *testing.T) {
+	withPositions := sampleProgram()
+	for i := range withPositions.Code {
+		withPositions.Positions = append(withPositions.Positions, Position{Line: 1 + i/6, Column: 1})
+	}
+
+	for _, p := range []Program{sampleProgram(), withPositions} {
+		data, err := Encode(p)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		got, err := Decode(data)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(got, p) {
+			t.Errorf("The decoded program differs from the encoded one! Got `%v`, want `%v`.", got, p)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	data, err := Encode(sampleProgram())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	corrupted := append([]byte(nil), data...)
+	corrupted[10] ^= 0xff
+	newer := append([]byte(nil), data...)
+	newer[len(Magic)] = Version + 1
+	trailing := append(append([]byte(nil), data[:len(data)-4]...), 0, 0, 0, 0, 0)
+
+	tests := []struct {
+		data []byte
+		want string
+	}{
+		{[]byte("+ 1 2"), "Not a compiled program!"},
+		{corrupted, "Checksum mismatch! The compiled program is corrupted."},
+		{resum(newer), "Unsupported bytecode version 3! Expected 2."},
+		{resum(data[:len(data)-10]), "Truncated or malformed bytecode!"},
+		{resum(trailing), "Truncated or malformed bytecode!"},
+	}
+
+	for _, tt := range tests {
+		if _, err := Decode(tt.data); err == nil || err.Error() != tt.want {
+			t.Errorf("Expected `%s`, got `%v`!", tt.want, err)
+		}
+	}
+}
+
+func TestEncodeInvalidProgram(t *testing.T) {
+	p := sampleProgram()
+	p.Code[6].Arg = 7
+	if _, err := Encode(p); err == nil || err.Error() != "Invalid constant 7 at instruction 6!" {
+		t.Errorf("Expected `Invalid constant 7 at instruction 6!`, got `%v`!", err)
+	}
+
+	p = sampleProgram()
+	p.Positions = []Position{{Line: 1, Column: 1}}
+	if _, err := Encode(p); err == nil || err.Error() != "Expected a position for each of the 12 instructions, got 1!" {
+		t.Errorf("Expected `Expected a position for each of the 12 instructions, got 1!`, got `%v`!", err)
+	}
+}
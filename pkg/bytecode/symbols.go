@@ -0,0 +1,27 @@
+package bytecode
+
+// A symbol table numbers the names of global variables, so that they can be
+// stored in slots and still be shown by name.
+type SymbolTable struct {
+	Names []string
+	slots map[string]int
+}
+
+func (t *SymbolTable) Lookup(name string) (int, bool) {
+	slot, ok := t.slots[name]
+	return slot, ok
+}
+
+// Add returns the slot of the name, giving it the next free one the first
+// time it is seen.
+func (t *SymbolTable) Add(name string) int {
+	if slot, ok := t.slots[name]; ok {
+		return slot
+	}
+	if t.slots == nil {
+		t.slots = map[string]int{}
+	}
+	t.slots[name] = len(t.Names)
+	t.Names = append(t.Names, name)
+	return len(t.Names) - 1
+}
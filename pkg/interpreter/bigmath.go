@@ -0,0 +1,161 @@
+package interpreter
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Every series below runs with some guard bits on top of the requested
+// precision and is rounded once at the end.
+const guardBits = 64
+
+func newBigFloat(prec uint) *big.Float {
+	return new(big.Float).SetPrec(prec)
+}
+
+// atan(1/n) = 1/n - 1/(3n^3) + 1/(5n^5) - ...
+func bigArctanInverse(n int64, prec uint) *big.Float {
+	x := newBigFloat(prec).Quo(newBigFloat(prec).SetInt64(1), newBigFloat(prec).SetInt64(n))
+	x2 := newBigFloat(prec).Mul(x, x)
+	sum := newBigFloat(prec).Set(x)
+	power := newBigFloat(prec).Set(x)
+	epsilon := newBigFloat(prec).SetMantExp(big.NewFloat(1), -int(prec))
+	for k := int64(1); ; k++ {
+		power.Mul(power, x2)
+		term := newBigFloat(prec).Quo(power, newBigFloat(prec).SetInt64(2*k+1))
+		if k%2 == 1 {
+			sum.Sub(sum, term)
+		} else {
+			sum.Add(sum, term)
+		}
+		if term.Cmp(epsilon) < 0 {
+			return sum
+		}
+	}
+}
+
+func bigPi(prec uint) *big.Float {
+	wp := prec + guardBits
+	a := newBigFloat(wp).Mul(newBigFloat(wp).SetInt64(16), bigArctanInverse(5, wp))
+	b := newBigFloat(wp).Mul(newBigFloat(wp).SetInt64(4), bigArctanInverse(239, wp))
+	return newBigFloat(prec).Sub(a, b)
+}
+
+func bigExp(x *big.Float) *big.Float {
+	prec := x.Prec()
+	wp := prec + guardBits
+
+	// exp(x) = exp(x / 2^k)^(2^k) with the reduced argument below one half.
+	r := newBigFloat(wp).Set(x)
+	k := 0
+	for half := big.NewFloat(0.5); new(big.Float).Abs(r).Cmp(half) > 0; k++ {
+		r.SetMantExp(r, -1)
+	}
+
+	sum := newBigFloat(wp).SetInt64(1)
+	term := newBigFloat(wp).SetInt64(1)
+	epsilon := newBigFloat(wp).SetMantExp(big.NewFloat(1), -int(wp))
+	for n := int64(1); ; n++ {
+		term.Mul(term, r)
+		term.Quo(term, newBigFloat(wp).SetInt64(n))
+		sum.Add(sum, term)
+		if new(big.Float).Abs(term).Cmp(epsilon) < 0 {
+			break
+		}
+	}
+	for ; k > 0; k-- {
+		sum.Mul(sum, sum)
+	}
+	return newBigFloat(prec).Set(sum)
+}
+
+// ln(m) = 2 * atanh((m - 1) / (m + 1)), which converges quickly for m close
+// to one; the binary exponent is handled separately with ln(2).
+func bigLogMantissa(m *big.Float, wp uint) *big.Float {
+	one := newBigFloat(wp).SetInt64(1)
+	s := newBigFloat(wp).Quo(newBigFloat(wp).Sub(m, one), newBigFloat(wp).Add(m, one))
+	s2 := newBigFloat(wp).Mul(s, s)
+	sum := newBigFloat(wp).Set(s)
+	power := newBigFloat(wp).Set(s)
+	epsilon := newBigFloat(wp).SetMantExp(big.NewFloat(1), -int(wp))
+	for k := int64(1); ; k++ {
+		power.Mul(power, s2)
+		term := newBigFloat(wp).Quo(power, newBigFloat(wp).SetInt64(2*k+1))
+		sum.Add(sum, term)
+		if new(big.Float).Abs(term).Cmp(epsilon) < 0 {
+			return sum.SetMantExp(sum, 1)
+		}
+	}
+}
+
+func bigLog(x *big.Float) (*big.Float, error) {
+	if x.Sign() <= 0 {
+		return nil, fmt.Errorf("Logarithm of a non-positive number!")
+	}
+	prec := x.Prec()
+	wp := prec + guardBits
+
+	m := newBigFloat(wp)
+	exp := x.MantExp(m)
+	result := bigLogMantissa(m, wp)
+	if exp != 0 {
+		ln2 := bigLogMantissa(newBigFloat(wp).SetInt64(2), wp)
+		result.Add(result, ln2.Mul(ln2, newBigFloat(wp).SetInt64(int64(exp))))
+	}
+	return newBigFloat(prec).Set(result), nil
+}
+
+func bigPow(x, y *big.Float) (*big.Float, error) {
+	prec := x.Prec()
+	if y.IsInt() && new(big.Float).Abs(y).Cmp(big.NewFloat(1<<31)) < 0 {
+		n, _ := y.Int64()
+		negative := n < 0
+		if negative {
+			n = -n
+		}
+		result := newBigFloat(prec).SetInt64(1)
+		base := newBigFloat(prec).Set(x)
+		for ; n > 0; n >>= 1 {
+			if n&1 == 1 {
+				result.Mul(result, base)
+			}
+			base.Mul(base, base)
+		}
+		if negative {
+			if result.Sign() == 0 {
+				return nil, fmt.Errorf("Division by zero!?")
+			}
+			result.Quo(newBigFloat(prec).SetInt64(1), result)
+		}
+		return result, nil
+	} else if x.Sign() < 0 {
+		return nil, fmt.Errorf("A negative base needs an integer exponent!")
+	} else if x.Sign() == 0 {
+		if y.Sign() < 0 {
+			return nil, fmt.Errorf("Division by zero!?")
+		}
+		return newBigFloat(prec), nil
+	} else if y.Cmp(big.NewFloat(0.5)) == 0 {
+		return newBigFloat(prec).Sqrt(x), nil
+	}
+
+	wide := newBigFloat(prec + guardBits)
+	ln, err := bigLog(wide.Set(x))
+	if err != nil {
+		return nil, err
+	}
+	result := bigExp(ln.Mul(ln, y))
+	return newBigFloat(prec).Set(result), nil
+}
+
+// An infinite quotient has no integer part, so neither has the remainder.
+func bigMod(x, y *big.Float) (*big.Float, error) {
+	prec := x.Prec()
+	quotient := newBigFloat(prec+guardBits).Quo(x, y)
+	if quotient.IsInf() {
+		return nil, fmt.Errorf("The result of `MOD` is not a number!")
+	}
+	truncated, _ := quotient.Int(nil)
+	product := newBigFloat(prec+guardBits).Mul(y, new(big.Float).SetInt(truncated))
+	return newBigFloat(prec).Sub(x, product), nil
+}
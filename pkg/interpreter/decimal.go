@@ -0,0 +1,215 @@
+package interpreter
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/sheikhartin/bytecode-based-calculator/pkg/bytecode"
+)
+
+type Rounding int
+
+const (
+	HalfEven Rounding = iota
+	HalfUp
+	Down
+	Ceiling
+)
+
+var roundingNames = map[Rounding]string{
+	HalfEven: "half-even",
+	HalfUp:   "half-up",
+	Down:     "down",
+	Ceiling:  "ceiling",
+}
+
+func (r Rounding) String() string {
+	return roundingNames[r]
+}
+
+func ParseRounding(name string) (Rounding, error) {
+	for rounding, roundingName := range roundingNames {
+		if name == roundingName {
+			return rounding, nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown rounding mode: %s", name)
+}
+
+// A decimal is the integer Coef scaled down by Scale decimal places. Every
+// value carries the rounding mode of its session, so that the results of
+// multiplication and division are rounded back to a fixed number of places.
+type Decimal struct {
+	Coef     *big.Int
+	Scale    int
+	Rounding Rounding
+}
+
+func (d Decimal) String() string {
+	text := new(big.Int).Abs(d.Coef).String()
+	if d.Scale > 0 {
+		if len(text) <= d.Scale {
+			text = strings.Repeat("0", d.Scale-len(text)+1) + text
+		}
+		text = text[:len(text)-d.Scale] + "." + text[len(text)-d.Scale:]
+	}
+	if d.Coef.Sign() < 0 {
+		text = "-" + text
+	}
+	return text
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// Divides and rounds the quotient to an integer with the given mode.
+func roundQuo(num, den *big.Int, rounding Rounding) *big.Int {
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+	sign := num.Sign() * den.Sign()
+	away := false
+	switch rounding {
+	case Ceiling:
+		away = sign > 0
+	case HalfUp, HalfEven:
+		switch new(big.Int).Abs(new(big.Int).Lsh(r, 1)).Cmp(new(big.Int).Abs(den)) {
+		case 1:
+			away = true
+		case 0:
+			away = rounding == HalfUp || q.Bit(0) == 1
+		}
+	}
+	if away {
+		q.Add(q, big.NewInt(int64(sign)))
+	}
+	return q
+}
+
+func roundRat(value *big.Rat, scale int, rounding Rounding) Decimal {
+	num := new(big.Int).Mul(value.Num(), pow10(scale))
+	return Decimal{Coef: roundQuo(num, value.Denom(), rounding), Scale: scale, Rounding: rounding}
+}
+
+func (d Decimal) Rat() *big.Rat {
+	return new(big.Rat).SetFrac(d.Coef, pow10(d.Scale))
+}
+
+func (d Decimal) rescale(scale int) Decimal {
+	if scale >= d.Scale {
+		coef := new(big.Int).Mul(d.Coef, pow10(scale-d.Scale))
+		return Decimal{Coef: coef, Scale: scale, Rounding: d.Rounding}
+	}
+	return roundRat(d.Rat(), scale, d.Rounding)
+}
+
+// Literals keep the places they are written with, so that `round` sees them
+// exactly, and only the results of operations are rounded to the places of
+// the mode.
+func (vm *VM) fixPlaces(value interface{}) interface{} {
+	if vm.Mode != DecimalMode {
+		return value
+	}
+	switch value := value.(type) {
+	case Decimal:
+		if value.Scale > vm.Places {
+			return value.rescale(vm.Places)
+		}
+	case Quantity:
+		return Quantity{Value: vm.fixPlaces(value.Value), Unit: value.Unit}
+	}
+	return value
+}
+
+func decimalArithmetic(op bytecode.Operator, left, right Decimal) (interface{}, error) {
+	scale := left.Scale
+	if right.Scale > scale {
+		scale = right.Scale
+	}
+	l, r := left.rescale(scale), right.rescale(scale)
+
+	switch op {
+	case bytecode.ADD:
+		return Decimal{Coef: new(big.Int).Add(l.Coef, r.Coef), Scale: scale, Rounding: l.Rounding}, nil
+	case bytecode.SUB:
+		return Decimal{Coef: new(big.Int).Sub(l.Coef, r.Coef), Scale: scale, Rounding: l.Rounding}, nil
+	case bytecode.MUL:
+		return roundRat(new(big.Rat).Mul(l.Rat(), r.Rat()), scale, l.Rounding), nil
+	case bytecode.DIV, bytecode.IDIV, bytecode.MOD:
+		if r.Coef.Sign() == 0 {
+			return nil, fmt.Errorf("Division by zero!?")
+		} else if op == bytecode.DIV {
+			return Decimal{Coef: roundQuo(new(big.Int).Mul(l.Coef, pow10(scale)), r.Coef, l.Rounding), Scale: scale, Rounding: l.Rounding}, nil
+		}
+		truncated := new(big.Int).Quo(l.Coef, r.Coef)
+		if op == bytecode.IDIV {
+			return Decimal{Coef: truncated.Mul(truncated, pow10(scale)), Scale: scale, Rounding: l.Rounding}, nil
+		}
+		remainder := new(big.Int).Sub(l.Coef, truncated.Mul(truncated, r.Coef))
+		return Decimal{Coef: remainder, Scale: scale, Rounding: l.Rounding}, nil
+	case bytecode.POW:
+		// ratPow also caps the exponent and the size, which keeps exact powers bounded.
+		power, err := ratPow(l.Rat(), r.Rat())
+		if err != nil {
+			return nil, err
+		} else if exact, ok := power.(*big.Rat); ok {
+			return roundRat(exact, scale, l.Rounding), nil
+		}
+		return power, nil
+	}
+	return nil, fmt.Errorf("Unknown binary operation: %s", op)
+}
+
+// Round is a native that rounds to a number of decimal places, either with
+// the given rounding mode or with the one of the session.
+func (vm *VM) Round(args ...interface{}) (interface{}, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, fmt.Errorf("Round requires a number, the decimal places and optionally a rounding mode!")
+	}
+	places, ok := toInteger(args[1])
+	if !ok || places.Sign() < 0 || !places.IsInt64() {
+		return nil, fmt.Errorf("The decimal places must be a non-negative integer, got `%v`!", args[1])
+	} else if places.Int64() > MaxPlaces {
+		return nil, fmt.Errorf("Too many decimal places: %v", places)
+	}
+	rounding := vm.Rounding
+	if len(args) == 3 {
+		if rounding, ok = args[2].(Rounding); !ok {
+			return nil, fmt.Errorf("Expected a rounding mode, got `%v`!", args[2])
+		}
+	}
+
+	var exact *big.Rat
+	switch x := args[0].(type) {
+	case *big.Int:
+		exact = new(big.Rat).SetInt(x)
+	case *big.Rat:
+		exact = x
+	case Decimal:
+		exact = x.Rat()
+	case float64:
+		exact = new(big.Rat)
+		if exact.SetFloat64(x) == nil {
+			return nil, fmt.Errorf("Cannot round `%v`!", x)
+		}
+	case *big.Float:
+		if x.IsInf() {
+			return nil, fmt.Errorf("Cannot round `%v`!", x)
+		}
+		exact, _ = x.Rat(nil)
+	default:
+		return nil, fmt.Errorf("Expected a real number, got `%v`!", args[0])
+	}
+
+	result := roundRat(exact, int(places.Int64()), rounding)
+	switch x := args[0].(type) {
+	case float64:
+		return convert(result, floatRank, 0), nil
+	case *big.Float:
+		return convert(result, bigFloatRank, x.Prec()), nil
+	}
+	return result, nil
+}
@@ -2,7 +2,12 @@ package interpreter
 
 import (
 	"fmt"
+	"math"
+	"math/big"
+	"math/cmplx"
 	"math/rand"
+
+	"github.com/sheikhartin/bytecode-based-calculator/pkg/bytecode"
 )
 
 const (
@@ -10,30 +15,59 @@ const (
 	E  = 2.718281828459045235360287
 )
 
-func Min(args ...interface{}) (interface{}, error) {
-	if len(args) < 2 {
-		return nil, fmt.Errorf("At least two arguments are expected!")
+func toFloat(arg interface{}) (float64, error) {
+	switch value := arg.(type) {
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(value).Float64()
+		return f, nil
+	case float64:
+		return value, nil
+	case *big.Rat:
+		f, _ := value.Float64()
+		return f, nil
+	case Decimal:
+		f, _ := value.Rat().Float64()
+		return f, nil
+	case *big.Float:
+		f, _ := value.Float64()
+		return f, nil
+	case complex128:
+		return 0, fmt.Errorf("Expected a real number, got `%v`!", arg)
 	}
-	min_ := args[0].(float64)
-	for _, arg := range args[1:] {
-		if arg.(float64) < min_ {
-			min_ = arg.(float64)
-		}
+	return 0, fmt.Errorf("Expected a number, got `%v`!", arg)
+}
+
+func singleNumber(name string, args []interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("%s requires exactly one argument!", name)
+	} else if !isNumber(args[0]) {
+		return nil, fmt.Errorf("Expected a number, got `%v`!", args[0])
 	}
-	return min_, nil
+	return args[0], nil
 }
 
-func Max(args ...interface{}) (interface{}, error) {
+func extreme(args []interface{}, wanted int) (interface{}, error) {
 	if len(args) < 2 {
 		return nil, fmt.Errorf("At least two arguments are expected!")
 	}
-	max_ := args[0].(float64)
+	result := args[0]
 	for _, arg := range args[1:] {
-		if arg.(float64) > max_ {
-			max_ = arg.(float64)
+		order, err := compareNumbers(bytecode.LT, arg, result)
+		if err != nil {
+			return nil, fmt.Errorf("Expected a number, got `%v`!", arg)
+		} else if order == wanted {
+			result = arg
 		}
 	}
-	return max_, nil
+	return result, nil
+}
+
+func Min(args ...interface{}) (interface{}, error) {
+	return extreme(args, -1)
+}
+
+func Max(args ...interface{}) (interface{}, error) {
+	return extreme(args, 1)
 }
 
 func Random(args ...interface{}) (interface{}, error) {
@@ -43,15 +77,160 @@ func Random(args ...interface{}) (interface{}, error) {
 	return rand.Float64(), nil
 }
 
+// Exact factorials beyond this take too long to be worth computing.
+const maxFactorial = 100000
+
+// The product is accumulated exactly and only rounded once, which keeps
+// `fact(25)` and beyond from overflowing. A float overflows past `fact(170)`
+// anyway, so it is not computed at all.
 func Factorial(args ...interface{}) (interface{}, error) {
-	if len(args) != 1 || args[0].(float64) < 0 {
+	if len(args) != 1 {
 		return nil, fmt.Errorf("Factorial requires a non-negative integer...")
-	} else if args[0].(float64) < 2 {
-		return 1.0, nil
 	}
-	var res int = 1
-	for i := 2; i <= int(args[0].(float64)); i++ {
-		res *= i
+	n, err := toFloat(args[0])
+	if err != nil || n < 0 || n != float64(int64(n)) {
+		return nil, fmt.Errorf("Factorial requires a non-negative integer...")
+	}
+	if _, ok := args[0].(float64); ok && n > 170 {
+		return math.Inf(1), nil
+	} else if n > maxFactorial {
+		return nil, fmt.Errorf("Factorial of %.0f is too large to compute!", n)
+	}
+	res := new(big.Int).MulRange(1, int64(n))
+	switch value := args[0].(type) {
+	case *big.Int:
+		return res, nil
+	case *big.Rat:
+		return new(big.Rat).SetInt(res), nil
+	case Decimal:
+		return Decimal{Coef: res.Mul(res, pow10(value.Scale)), Scale: value.Scale, Rounding: value.Rounding}, nil
+	case *big.Float:
+		return newBigFloat(value.Prec()).SetInt(res), nil
+	}
+	f, _ := new(big.Float).SetInt(res).Float64()
+	return f, nil
+}
+
+func Re(args ...interface{}) (interface{}, error) {
+	z, err := singleNumber("Re", args)
+	if c, ok := z.(complex128); ok {
+		return real(c), nil
+	}
+	return z, err
+}
+
+func Im(args ...interface{}) (interface{}, error) {
+	z, err := singleNumber("Im", args)
+	if err != nil {
+		return nil, err
+	} else if c, ok := z.(complex128); ok {
+		return imag(c), nil
+	}
+	return integerLike(0, z), nil
+}
+
+func Conj(args ...interface{}) (interface{}, error) {
+	z, err := singleNumber("Conj", args)
+	if c, ok := z.(complex128); ok {
+		return cmplx.Conj(c), nil
+	}
+	return z, err
+}
+
+func Abs(args ...interface{}) (interface{}, error) {
+	z, err := singleNumber("Abs", args)
+	if err != nil {
+		return nil, err
+	}
+	switch z := z.(type) {
+	case *big.Int:
+		return new(big.Int).Abs(z), nil
+	case *big.Rat:
+		return new(big.Rat).Abs(z), nil
+	case Decimal:
+		return Decimal{Coef: new(big.Int).Abs(z.Coef), Scale: z.Scale, Rounding: z.Rounding}, nil
+	case *big.Float:
+		return newBigFloat(z.Prec()).Abs(z), nil
+	case complex128:
+		return cmplx.Abs(z), nil
+	}
+	return math.Abs(z.(float64)), nil
+}
+
+func Arg(args ...interface{}) (interface{}, error) {
+	z, err := singleNumber("Arg", args)
+	if err != nil {
+		return nil, err
+	} else if c, ok := z.(complex128); ok {
+		return cmplx.Phase(c), nil
+	}
+	x, _ := toFloat(z)
+	return math.Atan2(0, x), nil
+}
+
+// Builds the complex number with the given magnitude and angle.
+func Polar(args ...interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("Polar requires a magnitude and an angle!")
+	}
+	r, err := toFloat(args[0])
+	if err != nil {
+		return nil, err
+	}
+	theta, err := toFloat(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return complexArithmetic(bytecode.MUL, complex(r, 0), cmplx.Rect(1, theta))
+}
+
+// Simpson's rule over a fixed number of intervals is plenty for the smooth
+// functions people type into a calculator.
+func (vm *VM) Integrate(args ...interface{}) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf("Integrate requires a function and two bounds!")
+	}
+	fn, ok := args[0].(*Function)
+	if !ok || len(fn.Params) != 1 {
+		return nil, fmt.Errorf("Integrate requires a function of one argument!")
+	}
+	a, b := vm.normalize(args[1]), vm.normalize(args[2])
+	if !isNumber(a) || !isNumber(b) {
+		return nil, fmt.Errorf("Integrate requires numeric bounds!")
+	}
+
+	// The weights are applied with the VM's own arithmetic so that the big
+	// modes keep their precision through the whole sum.
+	var err error
+	apply := func(op bytecode.Operator, left, right interface{}) interface{} {
+		if err != nil {
+			return nil
+		}
+		var result interface{}
+		result, err = arithmetic(op, left, right)
+		return result
+	}
+
+	const intervals = 1000
+	h := apply(bytecode.DIV, apply(bytecode.SUB, b, a), integerLike(intervals, a))
+	sum := integerLike(0, a)
+	for i := 0; i <= intervals && err == nil; i++ {
+		var y interface{}
+		y, err = vm.Call(fn, apply(bytecode.ADD, a, apply(bytecode.MUL, integerLike(int64(i), a), h)))
+		if err != nil {
+			return nil, err
+		} else if !isNumber(y) {
+			return nil, fmt.Errorf("Expected a number, got `%v`!", y)
+		}
+		switch {
+		case i == 0 || i == intervals:
+			sum = apply(bytecode.ADD, sum, y)
+		case i%2 == 1:
+			sum = apply(bytecode.ADD, sum, apply(bytecode.MUL, integerLike(4, y), y))
+		default:
+			sum = apply(bytecode.ADD, sum, apply(bytecode.MUL, integerLike(2, y), y))
+		}
 	}
-	return float64(res), nil
+	result := apply(bytecode.DIV, apply(bytecode.MUL, sum, h), integerLike(3, sum))
+	return result, err
 }
@@ -0,0 +1,607 @@
+package interpreter
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"math/cmplx"
+	"strconv"
+	"strings"
+
+	"github.com/sheikhartin/bytecode-based-calculator/pkg/bytecode"
+)
+
+type Mode int
+
+const (
+	FloatMode Mode = iota
+	BigFloatMode
+	RationalMode
+	DecimalMode
+)
+
+const DefaultPlaces = 2
+
+// Rounding to more places than this would only exhaust the memory, just like
+// an exact power beyond maxExponent.
+const MaxPlaces = maxExponent
+
+const DefaultPrecision = 256
+
+// Numbers of different types are combined in the wider of their types. An
+// exact integer or rational mixed with an inexact float becomes inexact as
+// well, and one mixed with a decimal is rounded to the places of the decimal.
+const (
+	notNumber = iota
+	integerRank
+	rationalRank
+	decimalRank
+	floatRank
+	bigFloatRank
+	complexRank
+)
+
+func rank(value interface{}) int {
+	switch value.(type) {
+	case *big.Int:
+		return integerRank
+	case *big.Rat:
+		return rationalRank
+	case Decimal:
+		return decimalRank
+	case float64:
+		return floatRank
+	case *big.Float:
+		return bigFloatRank
+	case complex128:
+		return complexRank
+	}
+	return notNumber
+}
+
+func isNumber(value interface{}) bool {
+	return rank(value) != notNumber
+}
+
+// Constants are parsed exactly by the compiler and only take the type of the
+// mode here, once per program. Integer literals stay exact in the float mode
+// and only become floats once they are mixed with one.
+func (vm *VM) fromConstant(c bytecode.Constant) (interface{}, error) {
+	if c.Kind == bytecode.IMAGINARY {
+		f, _ := c.Value.Float64()
+		if math.IsInf(f, 0) {
+			return nil, fmt.Errorf("Invalid number: %s", c.Text)
+		}
+		return complex(0, f), nil
+	} else if c.Kind == bytecode.INTEGER {
+		return vm.fromInteger(new(big.Int).Set(c.Value.Num())), nil
+	}
+
+	switch vm.Mode {
+	case BigFloatMode:
+		return newBigFloat(vm.Precision).SetRat(c.Value), nil
+	case RationalMode:
+		return new(big.Rat).Set(c.Value), nil
+	case DecimalMode:
+		places := c.Places()
+		if places < vm.Places {
+			places = vm.Places
+		}
+		return roundRat(c.Value, places, vm.Rounding), nil
+	}
+	f, _ := c.Value.Float64()
+	if math.IsInf(f, 0) {
+		return nil, fmt.Errorf("Invalid number: %s", c.Text)
+	}
+	return f, nil
+}
+
+func (vm *VM) fromInteger(value *big.Int) interface{} {
+	switch vm.Mode {
+	case BigFloatMode:
+		return newBigFloat(vm.Precision).SetInt(value)
+	case RationalMode:
+		return new(big.Rat).SetInt(value)
+	case DecimalMode:
+		return roundRat(new(big.Rat).SetInt(value), vm.Places, vm.Rounding)
+	}
+	return value
+}
+
+// Natives and stack words may still hand back plain floats, which are
+// widened so that a big session never silently drops to 64 bits.
+func (vm *VM) normalize(value interface{}) interface{} {
+	if f, ok := value.(float64); ok && vm.Mode == BigFloatMode {
+		return newBigFloat(vm.Precision).SetFloat64(f)
+	}
+	return value
+}
+
+func convert(value interface{}, to int, prec uint) interface{} {
+	switch to {
+	case rationalRank:
+		if i, ok := value.(*big.Int); ok {
+			return new(big.Rat).SetInt(i)
+		}
+	case floatRank:
+		switch value := value.(type) {
+		case *big.Int:
+			f, _ := new(big.Float).SetInt(value).Float64()
+			return f
+		case *big.Rat:
+			f, _ := value.Float64()
+			return f
+		case Decimal:
+			f, _ := value.Rat().Float64()
+			return f
+		}
+	case bigFloatRank:
+		switch value := value.(type) {
+		case *big.Int:
+			return newBigFloat(prec).SetInt(value)
+		case Decimal:
+			return newBigFloat(prec).SetRat(value.Rat())
+		case float64:
+			return newBigFloat(prec).SetFloat64(value)
+		case *big.Rat:
+			return newBigFloat(prec).SetRat(value)
+		}
+	case complexRank:
+		if _, ok := value.(complex128); !ok {
+			f, _ := toFloat(value)
+			return complex(f, 0)
+		}
+	}
+	return value
+}
+
+// Bitwise operations only make sense on whole numbers, which may still be
+// stored in one of the fractional types.
+func toInteger(value interface{}) (*big.Int, bool) {
+	switch value := value.(type) {
+	case *big.Int:
+		return value, true
+	case float64:
+		if value == math.Trunc(value) && !math.IsInf(value, 0) {
+			i, _ := big.NewFloat(value).Int(nil)
+			return i, true
+		}
+	case *big.Rat:
+		if value.IsInt() {
+			return new(big.Int).Set(value.Num()), true
+		}
+	case Decimal:
+		if r := value.Rat(); r.IsInt() {
+			return new(big.Int).Set(r.Num()), true
+		}
+	case *big.Float:
+		if value.IsInt() {
+			i, _ := value.Int(nil)
+			return i, true
+		}
+	}
+	return nil, false
+}
+
+// Constants used inside natives take the type of the values they are
+// combined with, so that they never make an exact result inexact.
+func integerLike(n int64, like interface{}) interface{} {
+	switch like.(type) {
+	case *big.Int, Decimal:
+		return big.NewInt(n)
+	case *big.Rat:
+		return new(big.Rat).SetInt64(n)
+	}
+	return float64(n)
+}
+
+func promote(left, right interface{}) (interface{}, interface{}) {
+	to := rank(left)
+	if rank(right) > to {
+		to = rank(right)
+	}
+	if to == decimalRank {
+		like, ok := left.(Decimal)
+		if !ok {
+			like = right.(Decimal)
+		}
+		return toDecimal(left, like), toDecimal(right, like)
+	}
+	var prec uint = DefaultPrecision
+	if b, ok := left.(*big.Float); ok {
+		prec = b.Prec()
+	} else if b, ok := right.(*big.Float); ok {
+		prec = b.Prec()
+	}
+	return convert(left, to, prec), convert(right, to, prec)
+}
+
+func toDecimal(value interface{}, like Decimal) Decimal {
+	switch value := value.(type) {
+	case *big.Int:
+		return roundRat(new(big.Rat).SetInt(value), like.Scale, like.Rounding)
+	case *big.Rat:
+		return roundRat(value, like.Scale, like.Rounding)
+	}
+	return value.(Decimal)
+}
+
+func arithmetic(op bytecode.Operator, left, right interface{}) (result interface{}, err error) {
+	if isQuantity(left) || isQuantity(right) {
+		return quantityArithmetic(op, left, right)
+	} else if !isNumber(left) || !isNumber(right) {
+		return nil, fmt.Errorf("Cannot apply `%s` to `%v` and `%v`!", op, left, right)
+	}
+	left, right = promote(left, right)
+	switch l := left.(type) {
+	case *big.Int:
+		return intArithmetic(op, l, right.(*big.Int))
+	case float64:
+		return floatArithmetic(op, l, right.(float64))
+	case *big.Rat:
+		return ratArithmetic(op, l, right.(*big.Rat))
+	case Decimal:
+		return decimalArithmetic(op, l, right.(Decimal))
+	case complex128:
+		return complexArithmetic(op, l, right.(complex128))
+	}
+
+	// Infinite operands make some big.Float operations panic instead of
+	// returning NaN, so the panic is turned back into an ordinary error.
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(big.ErrNaN); !ok {
+				panic(r)
+			}
+			result, err = nil, fmt.Errorf("The result of `%s` is not a number!", op)
+		}
+	}()
+	return bigArithmetic(op, left.(*big.Float), right.(*big.Float))
+}
+
+func intArithmetic(op bytecode.Operator, left, right *big.Int) (interface{}, error) {
+	switch op {
+	case bytecode.ADD:
+		return new(big.Int).Add(left, right), nil
+	case bytecode.SUB:
+		return new(big.Int).Sub(left, right), nil
+	case bytecode.MUL:
+		return new(big.Int).Mul(left, right), nil
+	case bytecode.DIV, bytecode.IDIV, bytecode.MOD:
+		if right.Sign() == 0 {
+			return nil, fmt.Errorf("Division by zero!?")
+		}
+		switch op {
+		case bytecode.IDIV:
+			return new(big.Int).Quo(left, right), nil
+		case bytecode.MOD:
+			return new(big.Int).Rem(left, right), nil
+		}
+		// A true quotient of integers is generally not an integer, so it is
+		// promoted to a float like any other mixed result.
+		f, _ := new(big.Rat).SetFrac(left, right).Float64()
+		return f, nil
+	case bytecode.POW:
+		if right.Sign() < 0 {
+			l, _ := new(big.Float).SetInt(left).Float64()
+			r, _ := new(big.Float).SetInt(right).Float64()
+			return math.Pow(l, r), nil
+		} else if right.Cmp(big.NewInt(maxExponent)) > 0 {
+			return nil, fmt.Errorf("Exponent too large: %v", right)
+		} else if powerTooLarge(left, right.Int64()) {
+			return nil, fmt.Errorf("The result of `%s` is too large!", op)
+		}
+		return new(big.Int).Exp(left, right, nil), nil
+	}
+	return nil, fmt.Errorf("Unknown binary operation: %s", op)
+}
+
+func floatArithmetic(op bytecode.Operator, left, right float64) (interface{}, error) {
+	switch op {
+	case bytecode.ADD:
+		return left + right, nil
+	case bytecode.SUB:
+		return left - right, nil
+	case bytecode.MUL:
+		return left * right, nil
+	case bytecode.DIV:
+		if right == 0 {
+			return nil, fmt.Errorf("Division by zero!?")
+		}
+		return left / right, nil
+	case bytecode.IDIV:
+		if right == 0 {
+			return nil, fmt.Errorf("Division by zero!?")
+		}
+		return math.Trunc(left / right), nil
+	case bytecode.MOD:
+		if right == 0 {
+			return nil, fmt.Errorf("Division by zero!?")
+		}
+		return math.Mod(left, right), nil
+	case bytecode.POW:
+		// Fractional powers of negative numbers have no real value, but
+		// they do have a complex one.
+		if left < 0 && right != math.Trunc(right) {
+			return complexArithmetic(op, complex(left, 0), complex(right, 0))
+		}
+		return math.Pow(left, right), nil
+	}
+	return nil, fmt.Errorf("Unknown binary operation: %s", op)
+}
+
+// Results without an imaginary part are plain reals again, so that `* i i`
+// can be used wherever -1 can.
+func complexArithmetic(op bytecode.Operator, left, right complex128) (interface{}, error) {
+	var result complex128
+	switch op {
+	case bytecode.ADD:
+		result = left + right
+	case bytecode.SUB:
+		result = left - right
+	case bytecode.MUL:
+		result = left * right
+	case bytecode.DIV:
+		if right == 0 {
+			return nil, fmt.Errorf("Division by zero!?")
+		}
+		result = left / right
+	case bytecode.POW:
+		result = complexPow(left, right)
+	case bytecode.IDIV, bytecode.MOD:
+		return nil, fmt.Errorf("Cannot apply `%s` to complex numbers!", op)
+	default:
+		return nil, fmt.Errorf("Unknown binary operation: %s", op)
+	}
+	if imag(result) == 0 {
+		return real(result), nil
+	}
+	return result, nil
+}
+
+// Small integer exponents are multiplied out, which avoids the rounding
+// noise of the logarithm in `cmplx.Pow` for cases like `^ i 2`.
+func complexPow(base, exponent complex128) complex128 {
+	n := real(exponent)
+	if imag(exponent) != 0 || n != math.Trunc(n) || math.Abs(n) > 64 {
+		if exponent == 0.5 {
+			return cmplx.Sqrt(base)
+		}
+		return cmplx.Pow(base, exponent)
+	}
+	result := complex(1, 0)
+	for i := 0; i < int(math.Abs(n)); i++ {
+		result *= base
+	}
+	if n < 0 {
+		return 1 / result
+	}
+	return result
+}
+
+func ratArithmetic(op bytecode.Operator, left, right *big.Rat) (interface{}, error) {
+	switch op {
+	case bytecode.ADD:
+		return new(big.Rat).Add(left, right), nil
+	case bytecode.SUB:
+		return new(big.Rat).Sub(left, right), nil
+	case bytecode.MUL:
+		return new(big.Rat).Mul(left, right), nil
+	case bytecode.DIV:
+		if right.Sign() == 0 {
+			return nil, fmt.Errorf("Division by zero!?")
+		}
+		return new(big.Rat).Quo(left, right), nil
+	case bytecode.IDIV, bytecode.MOD:
+		if right.Sign() == 0 {
+			return nil, fmt.Errorf("Division by zero!?")
+		}
+		quotient := new(big.Rat).Quo(left, right)
+		truncated := new(big.Rat).SetInt(new(big.Int).Quo(quotient.Num(), quotient.Denom()))
+		if op == bytecode.IDIV {
+			return truncated, nil
+		}
+		product := new(big.Rat).Mul(right, truncated)
+		return product.Sub(left, product), nil
+	case bytecode.POW:
+		return ratPow(left, right)
+	}
+	return nil, fmt.Errorf("Unknown binary operation: %s", op)
+}
+
+// Exact powers are refused beyond this exponent or once they would take more
+// bits than this, as computing them would only exhaust the memory.
+const (
+	maxExponent  = 1 << 20
+	maxPowerBits = 1 << 24
+)
+
+// The size of a power is estimated from the bits of its base, which is exact
+// for powers of two and falls short by less than the exponent otherwise.
+func powerTooLarge(base *big.Int, exponent int64) bool {
+	return int64(base.BitLen()-1)*exponent > maxPowerBits
+}
+
+// Only integer exponents keep a rational exact; anything else is irrational
+// in general and falls back to a float.
+func ratPow(base, exponent *big.Rat) (interface{}, error) {
+	if !exponent.IsInt() || !exponent.Num().IsInt64() {
+		b, _ := base.Float64()
+		e, _ := exponent.Float64()
+		return floatArithmetic(bytecode.POW, b, e)
+	}
+	n := exponent.Num().Int64()
+	if n < 0 {
+		if base.Sign() == 0 {
+			return nil, fmt.Errorf("Division by zero!?")
+		}
+		base, n = new(big.Rat).Inv(base), -n
+	}
+	if n > maxExponent {
+		return nil, fmt.Errorf("Exponent too large: %v", exponent.Num())
+	} else if powerTooLarge(base.Num(), n) || powerTooLarge(base.Denom(), n) {
+		return nil, fmt.Errorf("The result of `POW` is too large!")
+	}
+	power := big.NewInt(n)
+	num := new(big.Int).Exp(base.Num(), power, nil)
+	denom := new(big.Int).Exp(base.Denom(), power, nil)
+	return new(big.Rat).SetFrac(num, denom), nil
+}
+
+func bigArithmetic(op bytecode.Operator, left, right *big.Float) (interface{}, error) {
+	prec := left.Prec()
+	if right.Prec() > prec {
+		prec = right.Prec()
+	}
+	switch op {
+	case bytecode.ADD:
+		return newBigFloat(prec).Add(left, right), nil
+	case bytecode.SUB:
+		return newBigFloat(prec).Sub(left, right), nil
+	case bytecode.MUL:
+		return newBigFloat(prec).Mul(left, right), nil
+	case bytecode.DIV:
+		if right.Sign() == 0 {
+			return nil, fmt.Errorf("Division by zero!?")
+		}
+		return newBigFloat(prec).Quo(left, right), nil
+	case bytecode.IDIV:
+		if right.Sign() == 0 {
+			return nil, fmt.Errorf("Division by zero!?")
+		}
+		quotient := newBigFloat(prec+guardBits).Quo(left, right)
+		if quotient.IsInf() {
+			return nil, fmt.Errorf("The result of `%s` is not a number!", op)
+		}
+		truncated, _ := quotient.Int(nil)
+		return newBigFloat(prec).SetInt(truncated), nil
+	case bytecode.MOD:
+		if right.Sign() == 0 {
+			return nil, fmt.Errorf("Division by zero!?")
+		}
+		return bigMod(newBigFloat(prec).Set(left), right)
+	case bytecode.POW:
+		if left.Sign() < 0 && !right.IsInt() {
+			l, _ := left.Float64()
+			r, _ := right.Float64()
+			return complexArithmetic(op, complex(l, 0), complex(r, 0))
+		}
+		return bigPow(newBigFloat(prec).Set(left), right)
+	}
+	return nil, fmt.Errorf("Unknown binary operation: %s", op)
+}
+
+func compareNumbers(op bytecode.Operator, left, right interface{}) (int, error) {
+	if isQuantity(left) || isQuantity(right) {
+		return compareQuantities(op, left, right)
+	} else if !isNumber(left) || !isNumber(right) {
+		return 0, fmt.Errorf("Cannot apply `%s` to `%v` and `%v`!", op, left, right)
+	}
+	left, right = promote(left, right)
+	switch l := left.(type) {
+	case *big.Int:
+		return l.Cmp(right.(*big.Int)), nil
+	case float64:
+		r := right.(float64)
+		switch {
+		case l < r:
+			return -1, nil
+		case l > r:
+			return 1, nil
+		}
+		return 0, nil
+	case *big.Rat:
+		return l.Cmp(right.(*big.Rat)), nil
+	case Decimal:
+		return l.Rat().Cmp(right.(Decimal).Rat()), nil
+	case complex128:
+		// Complex numbers have no order, only equality.
+		if op != bytecode.EQ && op != bytecode.NE {
+			return 0, fmt.Errorf("Cannot apply `%s` to `%v` and `%v`! Complex numbers are not ordered.", op, left, right)
+		} else if l == right.(complex128) {
+			return 0, nil
+		}
+		return 1, nil
+	}
+	return left.(*big.Float).Cmp(right.(*big.Float)), nil
+}
+
+func negate(value interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case *big.Int:
+		return new(big.Int).Neg(value), nil
+	case float64:
+		return -value, nil
+	case *big.Rat:
+		return new(big.Rat).Neg(value), nil
+	case Decimal:
+		return Decimal{Coef: new(big.Int).Neg(value.Coef), Scale: value.Scale, Rounding: value.Rounding}, nil
+	case *big.Float:
+		return newBigFloat(value.Prec()).Neg(value), nil
+	case complex128:
+		return -value, nil
+	case Quantity:
+		negated, err := negate(value.Value)
+		return Quantity{Value: negated, Unit: value.Unit}, err
+	}
+	return nil, fmt.Errorf("Cannot apply `SUB` to `%v`!", value)
+}
+
+func (vm *VM) format(value interface{}) string {
+	switch value := value.(type) {
+	case Quantity:
+		return fmt.Sprintf("%s %s", vm.format(value.Value), value.Unit)
+	case *big.Float:
+		// Printing a few digits short of the full precision hides the
+		// rounding noise of the last bits, so `+ 0.1 0.2` shows up as 0.3.
+		digits := int(float64(value.Prec())*math.Log10(2)) - 3
+		if digits < 1 {
+			digits = 1
+		}
+		return value.Text('g', digits)
+	case *big.Rat:
+		if value.IsInt() || vm.Decimals <= 0 {
+			return value.RatString()
+		}
+		text := value.FloatString(vm.Decimals)
+		return strings.TrimSuffix(strings.TrimRight(text, "0"), ".")
+	case complex128:
+		if real(value) == 0 {
+			return strconv.FormatFloat(imag(value), 'g', -1, 64) + "i"
+		}
+		text := strconv.FormatComplex(value, 'g', -1, 128)
+		return strings.TrimSuffix(strings.TrimPrefix(text, "("), ")")
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// Shift counts beyond this would only exhaust the memory.
+const maxShift = 1 << 20
+
+func bitwise(op bytecode.Operator, left, right interface{}) (interface{}, error) {
+	l, lok := toInteger(left)
+	r, rok := toInteger(right)
+	if op == bytecode.BNOT && !lok {
+		return nil, fmt.Errorf("Cannot apply `%s` to `%v`! An integer is expected.", op, left)
+	} else if op != bytecode.BNOT && (!lok || !rok) {
+		return nil, fmt.Errorf("Cannot apply `%s` to `%v` and `%v`! Integers are expected.", op, left, right)
+	}
+	switch op {
+	case bytecode.BNOT:
+		return new(big.Int).Not(l), nil
+	case bytecode.BAND:
+		return new(big.Int).And(l, r), nil
+	case bytecode.BOR:
+		return new(big.Int).Or(l, r), nil
+	case bytecode.BXOR:
+		return new(big.Int).Xor(l, r), nil
+	case bytecode.SHL, bytecode.SHR:
+		if r.Sign() < 0 || r.Cmp(big.NewInt(maxShift)) > 0 {
+			return nil, fmt.Errorf("Invalid shift count: %v", r)
+		} else if op == bytecode.SHL {
+			return new(big.Int).Lsh(l, uint(r.Int64())), nil
+		}
+		return new(big.Int).Rsh(l, uint(r.Int64())), nil
+	}
+	return nil, fmt.Errorf("Unknown bitwise operation: %s", op)
+}
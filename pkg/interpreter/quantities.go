@@ -0,0 +1,218 @@
+package interpreter
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/sheikhartin/bytecode-based-calculator/pkg/bytecode"
+	"github.com/sheikhartin/bytecode-based-calculator/pkg/units"
+)
+
+type Quantity struct {
+	Value interface{}
+	Unit  units.Unit
+}
+
+func (q Quantity) String() string {
+	return fmt.Sprintf("%v %s", q.Value, q.Unit)
+}
+
+func isQuantity(value interface{}) bool {
+	_, ok := value.(Quantity)
+	return ok
+}
+
+// Plain numbers take part in quantity arithmetic as dimensionless amounts.
+func splitQuantity(value interface{}) (interface{}, units.Unit) {
+	if q, ok := value.(Quantity); ok {
+		return q.Value, q.Unit
+	}
+	return value, units.Dimensionless
+}
+
+// A result whose dimensions cancel out is an ordinary number again, scaled
+// by whatever is left of the units, so that `/ 1 km 1 m` is 1000.
+func makeQuantity(value interface{}, unit units.Unit) (interface{}, error) {
+	if !unit.IsDimensionless() {
+		return Quantity{Value: value, Unit: unit}, nil
+	} else if unit.Scale.Cmp(units.Dimensionless.Scale) == 0 {
+		return value, nil
+	}
+	return scale(value, unit.Scale)
+}
+
+// The amount of `from` expressed in `to`; the ratio stays exact when the
+// amount is.
+func rescale(value interface{}, from, to units.Unit) (interface{}, error) {
+	ratio := from.Ratio(to)
+	if ratio.Cmp(units.Dimensionless.Scale) == 0 {
+		return value, nil
+	}
+	return scale(value, ratio)
+}
+
+// An integer stays exact under a whole ratio, but a fractional one makes it
+// a float, as mixing it with a fractional literal would.
+func scale(value interface{}, ratio *big.Rat) (interface{}, error) {
+	if _, ok := value.(*big.Int); ok {
+		if ratio.IsInt() {
+			return arithmetic(bytecode.MUL, value, new(big.Int).Set(ratio.Num()))
+		}
+		return arithmetic(bytecode.MUL, value, convert(ratio, floatRank, 0))
+	}
+	return arithmetic(bytecode.MUL, value, ratio)
+}
+
+func quantityArithmetic(op bytecode.Operator, left, right interface{}) (interface{}, error) {
+	lv, lu := splitQuantity(left)
+	rv, ru := splitQuantity(right)
+	if !isNumber(lv) || !isNumber(rv) {
+		return nil, fmt.Errorf("Cannot apply `%s` to `%v` and `%v`!", op, left, right)
+	}
+
+	switch op {
+	case bytecode.MUL, bytecode.DIV:
+		value, err := arithmetic(op, lv, rv)
+		if err != nil {
+			return nil, err
+		} else if op == bytecode.MUL {
+			return makeQuantity(value, lu.Mul(ru))
+		}
+		return makeQuantity(value, lu.Div(ru))
+	case bytecode.POW:
+		if isQuantity(right) {
+			return nil, fmt.Errorf("The exponent `%v` must be dimensionless!", right)
+		}
+		unit, err := powerUnit(lu, rv)
+		if err != nil {
+			return nil, err
+		}
+		value, err := arithmetic(op, lv, rv)
+		if err != nil {
+			return nil, err
+		}
+		return makeQuantity(value, unit)
+	}
+
+	if lu.Dim != ru.Dim {
+		return nil, fmt.Errorf(
+			"Cannot apply `%s` to `%v` and `%v`! Their dimensions differ.",
+			op,
+			left,
+			right,
+		)
+	}
+	rv, err := rescale(rv, ru, lu)
+	if err != nil {
+		return nil, err
+	}
+	value, err := arithmetic(op, lv, rv)
+	if err != nil || op == bytecode.IDIV {
+		return value, err
+	}
+	return makeQuantity(value, lu)
+}
+
+// Integer powers always exist, within the limits of exact powers; roots only
+// when every exponent of the unit divides evenly, like the square root of an
+// area.
+func powerUnit(unit units.Unit, exponent interface{}) (units.Unit, error) {
+	if n, ok := toInteger(exponent); ok && n.IsInt64() {
+		power := n.Int64()
+		if power > maxExponent || power < -maxExponent {
+			return units.Unit{}, fmt.Errorf("Exponent too large: %v", n)
+		}
+		magnitude := power
+		if magnitude < 0 {
+			magnitude = -magnitude
+		}
+		if powerTooLarge(unit.Scale.Num(), magnitude) || powerTooLarge(unit.Scale.Denom(), magnitude) {
+			return units.Unit{}, fmt.Errorf("The result of `POW` is too large!")
+		}
+		return unit.Pow(int(power)), nil
+	}
+	f, err := toFloat(exponent)
+	if err == nil && f > 0 {
+		if n, ok := toInteger(1 / f); ok && n.IsInt64() {
+			if root, ok := unit.Root(int(n.Int64())); ok {
+				return root, nil
+			}
+		}
+	}
+	return units.Unit{}, fmt.Errorf("Cannot raise `%s` to the power of `%v`!", unit, exponent)
+}
+
+func compareQuantities(op bytecode.Operator, left, right interface{}) (int, error) {
+	lv, lu := splitQuantity(left)
+	rv, ru := splitQuantity(right)
+	if lu.Dim != ru.Dim {
+		return 0, fmt.Errorf(
+			"Cannot apply `%s` to `%v` and `%v`! Their dimensions differ.",
+			op,
+			left,
+			right,
+		)
+	}
+	rv, err := rescale(rv, ru, lu)
+	if err != nil {
+		return 0, err
+	}
+	return compareNumbers(op, lv, rv)
+}
+
+// Only the unit of the target matters, so both `to x km` and `to x 1 km`
+// express `x` in kilometers.
+func convertQuantity(value, target interface{}) (interface{}, error) {
+	tq, ok := target.(Quantity)
+	if !ok {
+		return nil, fmt.Errorf("Expected a unit to convert to, got `%v`!", target)
+	}
+	v, u := splitQuantity(value)
+	if !isNumber(v) {
+		return nil, fmt.Errorf("Cannot convert `%v` to `%s`!", value, tq.Unit)
+	} else if u.Dim != tq.Unit.Dim {
+		return nil, fmt.Errorf("Cannot convert `%v` to `%s`! Their dimensions differ.", value, tq.Unit)
+	}
+	converted, err := rescale(v, u, tq.Unit)
+	if err != nil {
+		return nil, err
+	}
+	return Quantity{Value: converted, Unit: tq.Unit}, nil
+}
+
+func (vm *VM) unitValue(name string) (Quantity, error) {
+	unit, ok := units.Lookup(name)
+	if !ok {
+		return Quantity{}, fmt.Errorf("Unknown unit: %s", name)
+	}
+	return Quantity{Value: vm.fromInteger(big.NewInt(1)), Unit: unit}, nil
+}
+
+func (vm *VM) applyUnit() error {
+	if len(vm.Stack) < 1 {
+		return fmt.Errorf("Stack underflow!")
+	}
+	unit, err := vm.unitValue(vm.curr.Name)
+	if err != nil {
+		return err
+	}
+	result, err := quantityArithmetic(bytecode.MUL, vm.Stack[len(vm.Stack)-1], unit)
+	if err != nil {
+		return err
+	}
+	vm.Stack[len(vm.Stack)-1] = result
+	return nil
+}
+
+func (vm *VM) convert() error {
+	if len(vm.Stack) < 2 {
+		return fmt.Errorf("Stack underflow!")
+	}
+	result, err := convertQuantity(vm.Stack[len(vm.Stack)-2], vm.Stack[len(vm.Stack)-1])
+	if err != nil {
+		return err
+	}
+	vm.Stack = vm.Stack[:len(vm.Stack)-2]
+	vm.Stack = append(vm.Stack, result)
+	return nil
+}
@@ -2,60 +2,268 @@ package interpreter
 
 import (
 	"fmt"
-	"math"
+	"math/big"
 	"reflect"
-	"strconv"
 	"strings"
+
+	"github.com/sheikhartin/bytecode-based-calculator/pkg/bytecode"
 )
 
+// The slots of a scope are numbered by the resolver, in the order their
+// names are bound.
+type scope struct {
+	slots  []interface{}
+	parent *scope
+}
+
+// A loaded program keeps its constants converted to the numbers of the mode
+// and maps its global slots to those of the VM.
+type program struct {
+	constants []interface{}
+	globals   []int
+}
+
+type Function struct {
+	Name    string
+	Params  []string
+	Code    []bytecode.Instruction
+	env     *scope
+	program *program
+}
+
+func (f Function) String() string {
+	return fmt.Sprintf("<function %s>", f.Name)
+}
+
+type frame struct {
+	code    []bytecode.Instruction
+	program *program
+	pc      int
+	scope   *scope
+}
+
+const DefaultMaxDepth = 1000
+
 type VM struct {
-	currOperands []string
-	Stack        []interface{}
-	Vars         map[string]interface{}
+	curr       bytecode.Instruction
+	frames     []*frame
+	MaxDepth   int
+	Mode       Mode
+	Precision  uint
+	Decimals   int
+	Places     int
+	Rounding   Rounding
+	Stack      []interface{}
+	Builtins   map[string]interface{}
+	Symbols    bytecode.SymbolTable
+	globals    []interface{}
+	constants  map[string]bool
+	predefined map[string]interface{}
+}
+
+type Option func(*VM)
+
+func WithBigFloat(precision uint) Option {
+	return func(vm *VM) {
+		vm.Mode = BigFloatMode
+		vm.Precision = precision
+	}
+}
+
+func WithDecimal(places int, rounding Rounding) Option {
+	return func(vm *VM) {
+		vm.Mode = DecimalMode
+		vm.Places = places
+		vm.Rounding = rounding
+	}
+}
+
+func WithRational() Option {
+	return func(vm *VM) {
+		vm.Mode = RationalMode
+	}
 }
 
 func (vm VM) String() string {
-	return fmt.Sprintf("%v", vm.Stack[len(vm.Stack)-1])
+	if len(vm.Stack) == 0 {
+		return ""
+	}
+	return vm.format(vm.Stack[len(vm.Stack)-1])
+}
+
+func (vm VM) StackString() string {
+	var levels []string
+	for i, value := range vm.Stack {
+		levels = append(levels, fmt.Sprintf("%d: %s", len(vm.Stack)-i, vm.format(value)))
+	}
+	return strings.Join(levels, "\n")
+}
+
+func (vm *VM) insertConstant() {
+	vm.Stack = append(vm.Stack, vm.currFrame().program.constants[vm.curr.Arg])
 }
 
-func (vm *VM) insertNumber() error {
-	value, err := strconv.ParseFloat(vm.currOperands[0], 64)
+func (vm *VM) currFrame() *frame {
+	return vm.frames[len(vm.frames)-1]
+}
+
+// Global slots that were never assigned fall back to the built-ins, the
+// predefined names and finally the units, so `s` is seconds until it is
+// assigned something else.
+func (vm *VM) loadGlobal() error {
+	slot := vm.currFrame().program.globals[vm.curr.Arg]
+	if value := vm.globals[slot]; value != nil {
+		vm.Stack = append(vm.Stack, value)
+		return nil
+	}
+
+	name := vm.Symbols.Names[slot]
+	value, ok := vm.Builtins[name]
+	if !ok {
+		value, ok = vm.predefined[name]
+	}
+	if !ok {
+		unit, err := vm.unitValue(name)
+		if err != nil {
+			return fmt.Errorf("Undefined variable: %s", name)
+		}
+		value = unit
+	}
+	vm.Stack = append(vm.Stack, value)
+	return nil
+}
+
+func (vm *VM) localScope() (*scope, error) {
+	s := vm.currFrame().scope
+	for depth := vm.curr.Depth; s != nil && depth > 0; depth-- {
+		s = s.parent
+	}
+	if s == nil || vm.curr.Arg >= len(s.slots) {
+		return nil, fmt.Errorf("No local scope for `%s`!", vm.curr.Name)
+	}
+	return s, nil
+}
+
+func (vm *VM) loadLocal() error {
+	s, err := vm.localScope()
 	if err != nil {
 		return err
 	}
+	// Only hand-written bytecode can read a slot before storing to it.
+	value := s.slots[vm.curr.Arg]
+	if value == nil {
+		return fmt.Errorf("Undefined variable: %s", vm.curr.Name)
+	}
 	vm.Stack = append(vm.Stack, value)
 	return nil
 }
 
-func (vm *VM) loadVariable() error {
-	value, ok := vm.Vars[vm.currOperands[0]]
-	if !ok {
-		return fmt.Errorf("Undefined variable: %s", vm.currOperands[0])
+func (vm *VM) makeFunction(name string, env *scope) error {
+	size := vm.curr.Arg
+	f := vm.currFrame()
+	if f.pc+size > len(f.code) {
+		return fmt.Errorf("Function `%s` exceeds the bytecode!", name)
 	}
-	vm.Stack = append(vm.Stack, value)
+
+	fn := &Function{
+		Name:    name,
+		Params:  vm.curr.Params,
+		Code:    f.code[f.pc : f.pc+size],
+		env:     env,
+		program: f.program,
+	}
+	f.pc += size
+	vm.Stack = append(vm.Stack, fn)
 	return nil
 }
 
-func (vm *VM) callFunction() error {
-	argCount, err := strconv.Atoi(vm.currOperands[1])
+func (vm *VM) bindArguments(fn *Function, argCount int) (*scope, error) {
+	if argCount != len(fn.Params) {
+		return nil, fmt.Errorf(
+			"Function `%s` expects %d arguments, got %d!",
+			fn.Name,
+			len(fn.Params),
+			argCount,
+		)
+	}
+
+	// The parameters take the first slots of the scope of the call.
+	locals := append([]interface{}(nil), vm.Stack[len(vm.Stack)-argCount:]...)
+	vm.Stack = vm.Stack[:len(vm.Stack)-argCount]
+	return &scope{slots: locals, parent: fn.env}, nil
+}
+
+func (vm *VM) callUserFunction(fn *Function, argCount int) error {
+	if len(vm.frames) > vm.MaxDepth {
+		return fmt.Errorf("Recursion limit exceeded! More than %d nested calls.", vm.MaxDepth)
+	}
+	s, err := vm.bindArguments(fn, argCount)
+	if err != nil {
+		return err
+	}
+	vm.frames = append(vm.frames, &frame{code: fn.Code, program: fn.program, scope: s})
+	return nil
+}
+
+// A tail call has nothing left to do in the current frame, so the callee
+// takes it over instead of growing the call stack.
+func (vm *VM) tailCallUserFunction(fn *Function, argCount int) error {
+	s, err := vm.bindArguments(fn, argCount)
 	if err != nil {
-		return fmt.Errorf("Invalid argument count: %s", vm.currOperands[1])
-	} else if len(vm.Stack) < argCount {
-		return fmt.Errorf("Not enough arguments on stack for function `%s`!", vm.currOperands[0])
+		return err
+	}
+	f := vm.currFrame()
+	f.code, f.program, f.pc, f.scope = fn.Code, fn.program, 0, s
+	return nil
+}
+
+func (vm *VM) Call(fn *Function, args ...interface{}) (interface{}, error) {
+	base := len(vm.frames)
+	vm.Stack = append(vm.Stack, args...)
+	if err := vm.callUserFunction(fn, len(args)); err != nil {
+		vm.Stack = vm.Stack[:len(vm.Stack)-len(args)]
+		return nil, err
+	} else if err := vm.run(base); err != nil {
+		vm.frames = vm.frames[:base]
+		return nil, err
+	}
+
+	result := vm.Stack[len(vm.Stack)-1]
+	vm.Stack = vm.Stack[:len(vm.Stack)-1]
+	return result, nil
+}
+
+func (vm *VM) returnFromFunction() {
+	vm.frames = vm.frames[:len(vm.frames)-1]
+}
+
+// The callee is loaded like any other variable and sits on top of its
+// arguments.
+func (vm *VM) callFunction(tail bool) error {
+	argCount := vm.curr.Arg
+	if argCount >= len(vm.Stack) {
+		return fmt.Errorf("Not enough arguments on stack for function `%s`!", vm.curr.Name)
 	}
 
-	fn, found := vm.Vars[vm.currOperands[0]]
-	if !found {
-		return fmt.Errorf("Function `%s` not found!", vm.currOperands[0])
+	fn := vm.Stack[len(vm.Stack)-1]
+	vm.Stack = vm.Stack[:len(vm.Stack)-1]
+	if userFn, ok := fn.(*Function); ok && tail {
+		return vm.tailCallUserFunction(userFn, argCount)
+	} else if ok {
+		return vm.callUserFunction(userFn, argCount)
 	}
 	fnValue := reflect.ValueOf(fn)
 	if fnValue.Kind() != reflect.Func {
-		return fmt.Errorf("`%s` is not callable!", vm.currOperands[0])
+		return fmt.Errorf("`%s` is not callable!", vm.curr.Name)
 	}
 
 	var callArgs []reflect.Value
 	for i := 0; i < argCount; i++ {
-		callArgs = append(callArgs, reflect.ValueOf(vm.Stack[len(vm.Stack)-argCount+i]))
+		arg := vm.Stack[len(vm.Stack)-argCount+i]
+		if arg == nil {
+			return fmt.Errorf("Undefined argument for function `%s`!", vm.curr.Name)
+		}
+		callArgs = append(callArgs, reflect.ValueOf(arg))
 	}
 	result := fnValue.Call(callArgs)
 	if err, ok := result[1].Interface().(error); ok && err != nil {
@@ -63,10 +271,32 @@ func (vm *VM) callFunction() error {
 	}
 
 	vm.Stack = vm.Stack[:len(vm.Stack)-argCount]
-	vm.Stack = append(vm.Stack, result[0].Interface())
+	vm.Stack = append(vm.Stack, vm.normalize(result[0].Interface()))
 	return nil
 }
 
+func truthy(value interface{}) (bool, error) {
+	switch value := value.(type) {
+	case bool:
+		return value, nil
+	case float64:
+		return value != 0, nil
+	case *big.Int:
+		return value.Sign() != 0, nil
+	case *big.Rat:
+		return value.Sign() != 0, nil
+	case Decimal:
+		return value.Coef.Sign() != 0, nil
+	case *big.Float:
+		return value.Sign() != 0, nil
+	case complex128:
+		return value != 0, nil
+	case Quantity:
+		return truthy(value.Value)
+	}
+	return false, fmt.Errorf("Expected a boolean or a number as the condition, got `%v`!", value)
+}
+
 func (vm *VM) performUnaryOperation() error {
 	if len(vm.Stack) < 1 {
 		return fmt.Errorf("Stack underflow!")
@@ -75,18 +305,34 @@ func (vm *VM) performUnaryOperation() error {
 
 	var result interface{}
 	var err error
-	switch vm.currOperands[0] {
-	case "FACT":
-		result, err = Factorial(operand)
-		if err != nil {
-			return err
+	switch vm.curr.Operator {
+	case bytecode.NOT:
+		var cond bool
+		cond, err = truthy(operand)
+		result = !cond
+	case bytecode.ADD, bytecode.SUB, bytecode.FACT, bytecode.SQRT:
+		if !isNumber(operand) && (!isQuantity(operand) || vm.curr.Operator == bytecode.FACT) {
+			return fmt.Errorf("Cannot apply `%s` to `%v`!", vm.curr.Operator, operand)
+		}
+		switch vm.curr.Operator {
+		case bytecode.ADD:
+			result = operand
+		case bytecode.SUB:
+			result, err = negate(operand)
+		case bytecode.FACT:
+			result, err = Factorial(operand)
+		case bytecode.SQRT:
+			result, err = arithmetic(bytecode.POW, operand, big.NewRat(1, 2))
 		}
 	default:
-		return fmt.Errorf("Unknown unary operation: %s", vm.currOperands[0])
+		return fmt.Errorf("Unknown unary operation: %s", vm.curr.Operator)
+	}
+	if err != nil {
+		return err
 	}
 
 	vm.Stack = vm.Stack[:len(vm.Stack)-1]
-	vm.Stack = append(vm.Stack, result)
+	vm.Stack = append(vm.Stack, vm.fixPlaces(result))
 	return nil
 }
 
@@ -94,31 +340,80 @@ func (vm *VM) performBinaryOperation() error {
 	if len(vm.Stack) < 2 {
 		return fmt.Errorf("Stack underflow!")
 	}
-	right := vm.Stack[len(vm.Stack)-1]
+	result, err := arithmetic(
+		vm.curr.Operator,
+		vm.Stack[len(vm.Stack)-2],
+		vm.Stack[len(vm.Stack)-1],
+	)
+	if err != nil {
+		return err
+	}
+
+	vm.Stack = vm.Stack[:len(vm.Stack)-2]
+	vm.Stack = append(vm.Stack, vm.fixPlaces(result))
+	return nil
+}
+
+func (vm *VM) performBitwiseOperation() error {
+	op := vm.curr.Operator
+	operands := 2
+	if op == bytecode.BNOT {
+		operands = 1
+	}
+	if len(vm.Stack) < operands {
+		return fmt.Errorf("Stack underflow!")
+	}
+
+	var result interface{}
+	var err error
+	if operands == 1 {
+		result, err = bitwise(op, vm.Stack[len(vm.Stack)-1], nil)
+	} else {
+		result, err = bitwise(op, vm.Stack[len(vm.Stack)-2], vm.Stack[len(vm.Stack)-1])
+	}
+	if err != nil {
+		return err
+	}
+
+	vm.Stack = vm.Stack[:len(vm.Stack)-operands]
+	vm.Stack = append(vm.Stack, result)
+	return nil
+}
+
+func (vm *VM) performComparison() error {
+	if len(vm.Stack) < 2 {
+		return fmt.Errorf("Stack underflow!")
+	}
+	op := vm.curr.Operator
 	left := vm.Stack[len(vm.Stack)-2]
+	right := vm.Stack[len(vm.Stack)-1]
 
-	var result float64
-	switch vm.currOperands[0] {
-	case "ADD":
-		result = left.(float64) + right.(float64)
-	case "SUB":
-		result = left.(float64) - right.(float64)
-	case "MUL":
-		result = left.(float64) * right.(float64)
-	case "DIV":
-		if right.(float64) == 0 {
-			return fmt.Errorf("Division by zero!?")
+	var result bool
+	lb, lok := left.(bool)
+	rb, rok := right.(bool)
+	if lok && rok && (op == bytecode.EQ || op == bytecode.NE) {
+		result = (lb == rb) == (op == bytecode.EQ)
+	} else {
+		order, err := compareNumbers(op, left, right)
+		if err != nil {
+			return err
 		}
-		result = left.(float64) / right.(float64)
-	case "MOD":
-		if right.(float64) == 0 {
-			return fmt.Errorf("Division by zero!?")
+		switch op {
+		case bytecode.LT:
+			result = order < 0
+		case bytecode.LE:
+			result = order <= 0
+		case bytecode.GT:
+			result = order > 0
+		case bytecode.GE:
+			result = order >= 0
+		case bytecode.EQ:
+			result = order == 0
+		case bytecode.NE:
+			result = order != 0
+		default:
+			return fmt.Errorf("Unknown comparison: %s", op)
 		}
-		result = math.Mod(left.(float64), right.(float64))
-	case "POW":
-		result = math.Pow(left.(float64), right.(float64))
-	default:
-		return fmt.Errorf("Unknown binary operation: %s", vm.currOperands[0])
 	}
 
 	vm.Stack = vm.Stack[:len(vm.Stack)-2]
@@ -126,60 +421,316 @@ func (vm *VM) performBinaryOperation() error {
 	return nil
 }
 
-func (vm *VM) setVariable() error {
+func (vm *VM) insertBoolean() error {
+	vm.Stack = append(vm.Stack, vm.curr.Bool())
+	return nil
+}
+
+// Built-ins and constants can only be shadowed by locals, never reassigned.
+func (vm *VM) checkAssignable(name string) error {
+	if _, ok := vm.Builtins[name]; ok {
+		return fmt.Errorf("Cannot assign to the built-in `%s`! Choose another name.", name)
+	} else if vm.constants[name] {
+		return fmt.Errorf("Cannot reassign the constant `%s`!", name)
+	}
+	return nil
+}
+
+func (vm *VM) storeGlobal() error {
+	slot := vm.currFrame().program.globals[vm.curr.Arg]
+	if len(vm.Stack) < 1 {
+		return fmt.Errorf("Stack underflow!")
+	} else if err := vm.checkAssignable(vm.Symbols.Names[slot]); err != nil {
+		return err
+	}
+	vm.globals[slot] = vm.Stack[len(vm.Stack)-1]
+	return nil
+}
+
+func (vm *VM) storeConstant() error {
+	if err := vm.storeGlobal(); err != nil {
+		return err
+	}
+	vm.constants[vm.Symbols.Names[vm.currFrame().program.globals[vm.curr.Arg]]] = true
+	return nil
+}
+
+func (vm *VM) pushScope() {
+	f := vm.currFrame()
+	f.scope = &scope{slots: make([]interface{}, vm.curr.Arg), parent: f.scope}
+}
+
+func (vm *VM) popScope() error {
+	f := vm.currFrame()
+	if f.scope == nil {
+		return fmt.Errorf("No scope to leave!")
+	}
+	f.scope = f.scope.parent
+	return nil
+}
+
+func (vm *VM) storeLocal() error {
 	if len(vm.Stack) < 1 {
 		return fmt.Errorf("Stack underflow!")
 	}
-	vm.Vars[vm.currOperands[0]] = vm.Stack[len(vm.Stack)-1]
+	s, err := vm.localScope()
+	if err != nil {
+		return err
+	}
+	s.slots[vm.curr.Arg] = vm.Stack[len(vm.Stack)-1]
+	vm.Stack = vm.Stack[:len(vm.Stack)-1]
+	return nil
+}
+
+func (vm *VM) manipulateStack(word bytecode.Opcode) error {
+	var required int
+	switch word {
+	case bytecode.DUP, bytecode.DROP:
+		required = 1
+	case bytecode.SWAP, bytecode.OVER:
+		required = 2
+	}
+	if len(vm.Stack) < required {
+		return fmt.Errorf("Stack underflow!")
+	}
+
+	top := len(vm.Stack) - 1
+	switch word {
+	case bytecode.DUP:
+		vm.Stack = append(vm.Stack, vm.Stack[top])
+	case bytecode.SWAP:
+		vm.Stack[top], vm.Stack[top-1] = vm.Stack[top-1], vm.Stack[top]
+	case bytecode.DROP:
+		vm.Stack = vm.Stack[:top]
+	case bytecode.OVER:
+		vm.Stack = append(vm.Stack, vm.Stack[top-1])
+	case bytecode.CLEAR:
+		vm.Stack = vm.Stack[:0]
+	}
 	return nil
 }
 
-func (vm *VM) Execute(instructions []string) error {
-	for _, instr := range instructions {
-		parts := strings.Split(instr, "\t")
-		vm.currOperands = parts[1:]
+func (vm *VM) jump(conditional, when bool) error {
+	target := vm.curr.Arg
+	f := vm.currFrame()
+	if target < 0 || target > len(f.code) {
+		return fmt.Errorf("Invalid jump target: %d", target)
+	}
+
+	if conditional {
+		if len(vm.Stack) < 1 {
+			return fmt.Errorf("Stack underflow!")
+		}
+		cond, err := truthy(vm.Stack[len(vm.Stack)-1])
+		if err != nil {
+			return err
+		}
+		vm.Stack = vm.Stack[:len(vm.Stack)-1]
+		if cond != when {
+			return nil
+		}
+	}
+	f.pc = target
+	return nil
+}
 
-		switch parts[0] {
-		case "PUSH_NUM":
-			if err := vm.insertNumber(); err != nil {
+func (vm *VM) run(base int) error {
+	for len(vm.frames) > base {
+		f := vm.currFrame()
+		if f.pc >= len(f.code) {
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			continue
+		}
+		vm.curr = f.code[f.pc]
+		f.pc++
+
+		switch vm.curr.Op {
+		case bytecode.PUSH_CONST:
+			vm.insertConstant()
+		case bytecode.PUSH_BOOL:
+			if err := vm.insertBoolean(); err != nil {
+				return err
+			}
+		case bytecode.LOAD_GLOBAL:
+			if err := vm.loadGlobal(); err != nil {
+				return err
+			}
+		case bytecode.LOAD_LOCAL:
+			if err := vm.loadLocal(); err != nil {
+				return err
+			}
+		case bytecode.CALL_FUNC:
+			if err := vm.callFunction(false); err != nil {
+				return err
+			}
+		case bytecode.TAIL_CALL:
+			if err := vm.callFunction(true); err != nil {
+				return err
+			}
+		case bytecode.MAKE_FUNC:
+			if err := vm.makeFunction(vm.curr.Name, nil); err != nil {
+				return err
+			}
+		case bytecode.MAKE_CLOSURE:
+			if err := vm.makeFunction("lambda", f.scope); err != nil {
+				return err
+			}
+		case bytecode.RETURN:
+			vm.returnFromFunction()
+		case bytecode.JUMP:
+			if err := vm.jump(false, false); err != nil {
 				return err
 			}
-		case "LOAD_VAR":
-			if err := vm.loadVariable(); err != nil {
+		case bytecode.JUMP_IF_FALSE:
+			if err := vm.jump(true, false); err != nil {
 				return err
 			}
-		case "CALL_FUNC":
-			if err := vm.callFunction(); err != nil {
+		case bytecode.JUMP_IF_TRUE:
+			if err := vm.jump(true, true); err != nil {
 				return err
 			}
-		case "UNARY_OP":
+		case bytecode.UNARY_OP:
 			if err := vm.performUnaryOperation(); err != nil {
 				return err
 			}
-		case "BINARY_OP":
+		case bytecode.BINARY_OP:
 			if err := vm.performBinaryOperation(); err != nil {
 				return err
 			}
-		case "STORE_VAR":
-			if err := vm.setVariable(); err != nil {
+		case bytecode.COMPARE:
+			if err := vm.performComparison(); err != nil {
+				return err
+			}
+		case bytecode.APPLY_UNIT:
+			if err := vm.applyUnit(); err != nil {
+				return err
+			}
+		case bytecode.CONVERT:
+			if err := vm.convert(); err != nil {
+				return err
+			}
+		case bytecode.BITWISE_OP:
+			if err := vm.performBitwiseOperation(); err != nil {
+				return err
+			}
+		case bytecode.STORE_GLOBAL:
+			if err := vm.storeGlobal(); err != nil {
+				return err
+			}
+		case bytecode.STORE_CONST:
+			if err := vm.storeConstant(); err != nil {
+				return err
+			}
+		case bytecode.PUSH_SCOPE:
+			vm.pushScope()
+		case bytecode.POP_SCOPE:
+			if err := vm.popScope(); err != nil {
+				return err
+			}
+		case bytecode.STORE_LOCAL:
+			if err := vm.storeLocal(); err != nil {
+				return err
+			}
+		case bytecode.DUP, bytecode.SWAP, bytecode.DROP, bytecode.OVER, bytecode.CLEAR:
+			if err := vm.manipulateStack(vm.curr.Op); err != nil {
 				return err
 			}
 		default:
-			return fmt.Errorf("Unknown instruction: %s", parts[0])
+			return fmt.Errorf("Unknown instruction: %s", vm.curr.Op)
 		}
 	}
 	return nil
 }
 
-func NewVM() *VM {
-	return &VM{
-		Vars: map[string]interface{}{
-			"PI":   PI,
-			"E":    E,
-			"rand": Random,
-			"fact": Factorial,
-			"min":  Min,
-			"max":  Max,
-		},
+// Each program numbers its globals on its own, so they are linked to the slots
+// of the VM by name when it is loaded. The globals of earlier programs keep
+// their slots, which is how variables live on between the lines of the REPL.
+func (vm *VM) load(p bytecode.Program) (*program, error) {
+	loaded := &program{constants: make([]interface{}, len(p.Constants)), globals: make([]int, len(p.Symbols))}
+	for i, c := range p.Constants {
+		value, err := vm.fromConstant(c)
+		if err != nil {
+			return nil, err
+		}
+		loaded.constants[i] = value
+	}
+	for i, name := range p.Symbols {
+		loaded.globals[i] = vm.Symbols.Add(name)
+	}
+	for len(vm.globals) < len(vm.Symbols.Names) {
+		vm.globals = append(vm.globals, nil)
+	}
+	return loaded, nil
+}
+
+// Variables lists the globals that have been assigned so far, which a parser
+// of the next program has to treat as variables rather than units.
+func (vm *VM) Variables() []string {
+	var names []string
+	for slot, value := range vm.globals {
+		if value != nil {
+			names = append(names, vm.Symbols.Names[slot])
+		}
+	}
+	return names
+}
+
+// The bytecode is validated and loaded once up front, so that running it only
+// has to check what depends on the values on the stack.
+func (vm *VM) Execute(p bytecode.Program) error {
+	if err := bytecode.Validate(p); err != nil {
+		return err
+	}
+	loaded, err := vm.load(p)
+	if err != nil {
+		return err
+	}
+	base := len(vm.frames)
+	vm.frames = append(vm.frames, &frame{code: p.Code, program: loaded})
+	if err := vm.run(base); err != nil {
+		vm.frames = vm.frames[:base]
+		return err
+	}
+	return nil
+}
+
+func NewVM(options ...Option) *VM {
+	vm := &VM{MaxDepth: DefaultMaxDepth, Places: DefaultPlaces}
+	for _, option := range options {
+		option(vm)
+	}
+	vm.constants = map[string]bool{}
+	vm.Builtins = map[string]interface{}{
+		"PI":    vm.normalize(PI),
+		"E":     vm.normalize(E),
+		"true":  true,
+		"false": false,
+		"rand":  Random,
+		"fact":  Factorial,
+		"min":   Min,
+		"max":   Max,
+		"integ": vm.Integrate,
+		"re":    Re,
+		"im":    Im,
+		"conj":  Conj,
+		"abs":   Abs,
+		"arg":   Arg,
+		"polar": Polar,
+		"round": vm.Round,
+	}
+	// Short names that programs like to use for themselves live behind the
+	// variables just like the units, so assigning them only shadows them.
+	vm.predefined = map[string]interface{}{
+		"i":        complex(0, 1),
+		"halfEven": HalfEven,
+		"halfUp":   HalfUp,
+		"down":     Down,
+		"ceiling":  Ceiling,
+	}
+	if vm.Mode == BigFloatMode {
+		vm.Builtins["PI"] = bigPi(vm.Precision)
+		vm.Builtins["E"] = bigExp(newBigFloat(vm.Precision).SetInt64(1))
 	}
+	vm.Builtins["π"] = vm.Builtins["PI"]
+	return vm
 }
@@ -1,73 +1,292 @@
 package interpreter
 
 import (
+	"math"
+	"math/big"
 	"reflect"
 	"testing"
 
+	"github.com/sheikhartin/bytecode-based-calculator/pkg/bytecode"
 	"github.com/sheikhartin/bytecode-based-calculator/pkg/parser"
 )
 
+// compile lexes, parses and generates the input in the given notation,
+// stopping the test if any of them fails.
+func compile(t *testing.T, notation, input string, options ...parser.ParserOption) bytecode.Program {
+	t.Helper()
+	l, err := parser.NewLexer(input)
+	if err != nil {
+		t.Fatalf("Failed to tokenize input `%s`: %v", input, err)
+	}
+	var nodes []parser.ASTNode
+	switch notation {
+	case "infix":
+		p, err := parser.NewInfixParser(l.Tokens, options...)
+		if err != nil {
+			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", input, err)
+		}
+		nodes = p.Nodes
+	case "postfix":
+		p, err := parser.NewPostfixParser(l.Tokens, options...)
+		if err != nil {
+			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", input, err)
+		}
+		nodes = p.Nodes
+	default:
+		p, err := parser.NewParser(l.Tokens, options...)
+		if err != nil {
+			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", input, err)
+		}
+		nodes = p.Nodes
+	}
+	return parser.NewBytecodeGenerator(nodes).Program()
+}
+
+// execute runs the compiled input on the VM, stopping the test on an error.
+func execute(t *testing.T, vm *VM, program bytecode.Program, input string) {
+	t.Helper()
+	if err := vm.Execute(program); err != nil {
+		t.Fatalf("Execution error for input `%s`: %v", input, err)
+	}
+}
+
+// run executes the prefix input on a new VM with the options and returns
+// the VM to look at its stack or output.
+func run(t *testing.T, input string, options ...Option) *VM {
+	t.Helper()
+	vm := NewVM(options...)
+	execute(t, vm, compile(t, "prefix", input), input)
+	return vm
+}
+
+// top returns the value the last execution left on the stack.
+func top(vm *VM) interface{} {
+	return vm.Stack[len(vm.Stack)-1]
+}
+
+// expect reports the output of the input if it is not the wanted one.
+func expect(t *testing.T, input string, got, want interface{}) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf(
+			"The execution output does not match the expectations! Input `%s`, got `%v`, want `%v`.",
+			input,
+			got,
+			want,
+		)
+	}
+}
+
 func TestProcessNumbers(t *testing.T) {
 	tests := []struct {
 		input string
-		want  float64
+		want  interface{}
 	}{
-		{"358", 358},
+		{"358", big.NewInt(358)},
 		{"2.7182", 2.7182},
 	}
 
 	for _, tt := range tests {
-		l, err := parser.NewLexer(tt.input)
-		if err != nil {
-			t.Fatalf("Failed to tokenize input `%s`: %v", tt.input, err)
-			continue
-		}
-		p, err := parser.NewParser(l.Tokens)
-		if err != nil {
-			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", tt.input, err)
-			continue
+		expect(t, tt.input, top(run(t, tt.input)), tt.want)
+	}
+}
+
+func TestProcessFunctionCalls(t *testing.T) {
+	tests := []struct {
+		input string
+		want  interface{}
+	}{
+		{"fact(3)", big.NewInt(6)},
+		{"min(5, 10, 15, 20)", big.NewInt(5)},
+		{"max(5, 10, 15, 20)", big.NewInt(20)},
+	}
+
+	for _, tt := range tests {
+		expect(t, tt.input, top(run(t, tt.input)), tt.want)
+	}
+}
+
+func TestProcessUnaryOperations(t *testing.T) {
+	tests := []struct {
+		input string
+		want  interface{}
+	}{
+		{"! 5", big.NewInt(120)},
+		{"! ! 0", big.NewInt(1)},
+	}
+
+	for _, tt := range tests {
+		expect(t, tt.input, top(run(t, tt.input)), tt.want)
+	}
+}
+
+func TestProcessBinaryOperations(t *testing.T) {
+	tests := []struct {
+		input string
+		want  interface{}
+	}{
+		{"- PI E", 0.423310825130748},
+		{"% - 50 10 2", big.NewInt(0)},
+	}
+
+	for _, tt := range tests {
+		expect(t, tt.input, top(run(t, tt.input)), tt.want)
+	}
+}
+
+func TestProcessVariableDeclaration(t *testing.T) {
+	tests := []struct {
+		input string
+		want  interface{}
+	}{
+		{"x = 10", big.NewInt(10)},
+		{"y = x", big.NewInt(10)},
+	}
+
+	vm := NewVM() // To keep the variable in the next rounds
+	for _, tt := range tests {
+		execute(t, vm, compile(t, "prefix", tt.input), tt.input)
+		expect(t, tt.input, top(vm), tt.want)
+	}
+}
+
+func TestProcessConstants(t *testing.T) {
+	tests := []struct {
+		input string
+		want  interface{}
+	}{
+		{"const g = 9.81 ;; * g 2", 19.62},
+		{"x = 1 ;; const x = 2 ;; x", big.NewInt(2)},
+		{"const k = 2 ;; let k = 3 in * k k", big.NewInt(9)},
+		{"def f(PI) = * PI 2 ;; f(4)", big.NewInt(8)},
+		{"i = 3 ;; + i 1", big.NewInt(4)},
+	}
+
+	for _, tt := range tests {
+		expect(t, tt.input, top(run(t, tt.input)), tt.want)
+	}
+}
+
+func TestReassignmentErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"PI = 3", "Cannot assign to the built-in `PI`! Choose another name."},
+		{"min = 5", "Cannot assign to the built-in `min`! Choose another name."},
+		{"def max(a, b) = a", "Cannot assign to the built-in `max`! Choose another name."},
+		{"const PI = 3", "Cannot assign to the built-in `PI`! Choose another name."},
+		{"const g = 9.81 ;; g = 10", "Cannot reassign the constant `g`!"},
+		{"const g = 9.81 ;; const g = 10", "Cannot reassign the constant `g`!"},
+	}
+
+	for _, tt := range tests {
+		if err := NewVM().Execute(compile(t, "prefix", tt.input)); err == nil || err.Error() != tt.want {
+			t.Errorf("Expected `%s` for input `%s`, got `%v`!", tt.want, tt.input, err)
 		}
-		g := parser.NewBytecodeGenerator(p.Nodes)
+	}
+}
+
+func TestProcessInfixExpressions(t *testing.T) {
+	tests := []struct {
+		input string
+		want  interface{}
+	}{
+		{"1 + 2 * 3", big.NewInt(7)},
+		{"(1 + 2) * 3", big.NewInt(9)},
+		{"-2 ^ 2", big.NewInt(-4)},
+		{"10 - 4 - 3", big.NewInt(3)},
+		{"max(1, 2 * 3) + 3!", big.NewInt(12)},
+	}
+
+	for _, tt := range tests {
 		vm := NewVM()
-		if err := vm.Execute(g.Bytecode); err != nil {
-			t.Fatalf("Execution error for input `%s`: %v", tt.input, err)
-		} else if got := vm.Stack[len(vm.Stack)-1]; !reflect.DeepEqual(got, tt.want) {
+		execute(t, vm, compile(t, "infix", tt.input), tt.input)
+		expect(t, tt.input, top(vm), tt.want)
+	}
+}
+
+func TestProcessPostfixStack(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []interface{}
+	}{
+		{"3 4", []interface{}{big.NewInt(3), big.NewInt(4)}},
+		{"+ 2 *", []interface{}{big.NewInt(14)}},
+		{"dup 1 over", []interface{}{big.NewInt(14), big.NewInt(14), big.NewInt(1), big.NewInt(14)}},
+		{"swap drop", []interface{}{big.NewInt(14), big.NewInt(14), big.NewInt(14)}},
+		{"clear 5", []interface{}{big.NewInt(5)}},
+	}
+
+	vm := NewVM() // The stack is deliberately kept between lines
+	for _, tt := range tests {
+		execute(t, vm, compile(t, "postfix", tt.input), tt.input)
+		if !reflect.DeepEqual(vm.Stack, tt.want) {
 			t.Errorf(
-				"The execution output does not match the expectations! Input `%s`, got `%v`, want `%v`.",
+				"The stack does not match the expectations! Input `%s`, got `%v`, want `%v`.",
 				tt.input,
-				got,
+				vm.Stack,
 				tt.want,
 			)
 		}
 	}
+
+	if err := vm.Execute(bytecode.Program{Code: []bytecode.Instruction{{Op: bytecode.CLEAR}, {Op: bytecode.SWAP}}}); err == nil {
+		t.Errorf("Expected a stack underflow error.")
+	}
 }
 
-func TestProcessFunctionCalls(t *testing.T) {
+func TestProcessPrograms(t *testing.T) {
+	tests := []struct {
+		input string
+		want  interface{}
+	}{
+		{"x = 4 ;; y = * x 2 ;; + x y", big.NewInt(12)},
+		{"a = 1\nb = + a 1\n\n^ b 3\n", big.NewInt(8)},
+	}
+
+	for _, tt := range tests {
+		expect(t, tt.input, top(run(t, tt.input)), tt.want)
+	}
+}
+
+func TestProcessUserFunctions(t *testing.T) {
+	tests := []struct {
+		input string
+		want  interface{}
+	}{
+		{"def hyp(a, b) = ^ + ^ a 2 ^ b 2 0.5 ;; hyp(3, 4)", 5.0},
+		{"def sq(x) = * x x ;; def sumsq(x, y) = + sq(x) sq(y) ;; sumsq(2, 3)", big.NewInt(13)},
+		{"x = 100 ;; def shadow(x) = x ;; + shadow(1) x", big.NewInt(101)},
+		{"def avg(a, b) = / + a b 2 ;; max(avg(1, 3), 1)", 2.0},
+	}
+
+	for _, tt := range tests {
+		expect(t, tt.input, top(run(t, tt.input)), tt.want)
+	}
+}
+
+func TestUserFunctionArity(t *testing.T) {
+	input := "def sq(x) = * x x ;; sq(1, 2)"
+
+	if err := NewVM().Execute(compile(t, "prefix", input)); err == nil {
+		t.Errorf("Expected an arity error for input `%s`.", input)
+	}
+}
+
+func TestProcessClosures(t *testing.T) {
 	tests := []struct {
 		input string
 		want  float64
 	}{
-		{"fact(3)", 6},
-		{"min(5, 10, 15, 20)", 5},
-		{"max(5, 10, 15, 20)", 20},
+		{"sq = fn(x) * x x ;; sq(7)", 49},
+		{"def adder(n) = fn(x) + x n ;; add5 = adder(5) ;; add2 = adder(2) ;; + add5(10) add2(10)", 27},
+		{"def twice(f, x) = f(f(x)) ;; twice(fn(y) * y 3, 2)", 18},
+		{"k = 2 ;; integ(fn(x) * k x, 0, 3)", 9},
 	}
 
 	for _, tt := range tests {
-		l, err := parser.NewLexer(tt.input)
-		if err != nil {
-			t.Fatalf("Failed to tokenize input `%s`: %v", tt.input, err)
-			continue
-		}
-		p, err := parser.NewParser(l.Tokens)
-		if err != nil {
-			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", tt.input, err)
-			continue
-		}
-		g := parser.NewBytecodeGenerator(p.Nodes)
-		vm := NewVM()
-		if err := vm.Execute(g.Bytecode); err != nil {
-			t.Fatalf("Execution error for input `%s`: %v", tt.input, err)
-		} else if got := vm.Stack[len(vm.Stack)-1]; !reflect.DeepEqual(got, tt.want) {
+		if got, _ := toFloat(top(run(t, tt.input))); math.Abs(got-tt.want) > 1e-9 {
 			t.Errorf(
 				"The execution output does not match the expectations! Input `%s`, got `%v`, want `%v`.",
 				tt.input,
@@ -78,107 +297,615 @@ func TestProcessFunctionCalls(t *testing.T) {
 	}
 }
 
-func TestProcessUnaryOperations(t *testing.T) {
+func TestProcessConditionals(t *testing.T) {
 	tests := []struct {
 		input string
-		want  float64
+		want  interface{}
 	}{
-		{"! 5", 120},
-		{"! ! 0", 1},
+		{"? 1 10 20", big.NewInt(10)},
+		{"? 0 10 20", big.NewInt(20)},
+		{"? 0 / 1 0 5", big.NewInt(5)},
+		{"? - 2 2 undefined 3", big.NewInt(3)},
+		{"def sign(x) = ? x ? - x max(x, 0) -1 1 0 ;; + sign(-4) sign(0)", big.NewInt(-1)},
 	}
 
 	for _, tt := range tests {
-		l, err := parser.NewLexer(tt.input)
-		if err != nil {
-			t.Fatalf("Failed to tokenize input `%s`: %v", tt.input, err)
-			continue
+		expect(t, tt.input, top(run(t, tt.input)), tt.want)
+	}
+}
+
+func TestProcessBooleans(t *testing.T) {
+	tests := []struct {
+		input string
+		want  interface{}
+	}{
+		{"< 1 2", true},
+		{">= 1 2", false},
+		{"== true not false", true},
+		{"!= 3 3", false},
+		{"and false undefined", false},
+		{"or true / 1 0", true},
+		{"and < 1 2 > 3 2", true},
+		{"? <= 2 1 10 20", big.NewInt(20)},
+	}
+
+	for _, tt := range tests {
+		expect(t, tt.input, top(run(t, tt.input)), tt.want)
+	}
+}
+
+func TestBooleanTypeErrors(t *testing.T) {
+	inputs := []string{"+ true 1", "- false 1", "< true false", "== true 1", "! true", "max(true, 1)"}
+
+	for _, input := range inputs {
+		if err := NewVM().Execute(compile(t, "prefix", input)); err == nil {
+			t.Errorf("Expected a type error for input `%s`.", input)
 		}
-		p, err := parser.NewParser(l.Tokens)
-		if err != nil {
-			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", tt.input, err)
-			continue
+	}
+}
+
+func TestProcessSeries(t *testing.T) {
+	tests := []struct {
+		input string
+		want  interface{}
+	}{
+		{"sum(i, 1, 10, i)", big.NewInt(55)},
+		{"prod(i, 1, 5, i)", big.NewInt(120)},
+		{"sum(i, 5, 1, i)", big.NewInt(0)},
+		{"sum(i, 1, 3, sum(j, 1, i, j))", big.NewInt(10)},
+		{"n = 4 ;; sum(i, 1, n, ^ i 2)", big.NewInt(30)},
+		{"i = 100 ;; + sum(i, 1, 3, i) i", big.NewInt(106)},
+		{"def tri(n) = sum(i, 1, n, i) ;; prod(i, 1, 3, tri(i))", big.NewInt(18)},
+	}
+
+	for _, tt := range tests {
+		expect(t, tt.input, top(run(t, tt.input)), tt.want)
+	}
+}
+
+func TestSeriesClosuresKeepTheirIndex(t *testing.T) {
+	input := "sum(i, 1, 3, keep(fn(x) + x i))"
+
+	// The closures escape the loop through a native and are called after it.
+	var kept []*Function
+	vm := NewVM()
+	vm.Builtins["keep"] = func(args ...interface{}) (interface{}, error) {
+		kept = append(kept, args[0].(*Function))
+		return big.NewInt(0), nil
+	}
+	execute(t, vm, compile(t, "prefix", input), input)
+	if len(kept) != 3 {
+		t.Fatalf("Expected 3 closures, got %d!", len(kept))
+	}
+	for i, fn := range kept {
+		if got, err := vm.Call(fn, big.NewInt(0)); err != nil || !reflect.DeepEqual(got, big.NewInt(int64(i+1))) {
+			t.Errorf("Expected closure %d to return %d, got `%v` (%v)!", i, i+1, got, err)
 		}
-		g := parser.NewBytecodeGenerator(p.Nodes)
-		vm := NewVM()
-		if err := vm.Execute(g.Bytecode); err != nil {
-			t.Fatalf("Execution error for input `%s`: %v", tt.input, err)
-		} else if got := vm.Stack[len(vm.Stack)-1]; !reflect.DeepEqual(got, tt.want) {
-			t.Errorf(
-				"The execution output does not match the expectations! Input `%s`, got `%v`, want `%v`.",
-				tt.input,
-				got,
-				tt.want,
-			)
+	}
+}
+
+func TestProcessRecursion(t *testing.T) {
+	tests := []struct {
+		input string
+		want  interface{}
+	}{
+		{"def f(n) = ? <= n 1 1 * n f(- n 1) ;; f(10)", big.NewInt(3628800)},
+		{"def fib(n) = ? < n 2 n + fib(- n 1) fib(- n 2) ;; fib(15)", big.NewInt(610)},
+		{"def count(n, acc) = ? <= n 0 acc count(- n 1, + acc 1) ;; count(100000, 0)", big.NewInt(100000)},
+		{"def even(n) = ? == n 0 true odd(- n 1) ;; def odd(n) = ? == n 0 false even(- n 1) ;; ? even(50001) 1 0", big.NewInt(0)},
+	}
+
+	for _, tt := range tests {
+		expect(t, tt.input, top(run(t, tt.input)), tt.want)
+	}
+}
+
+func TestRecursionLimit(t *testing.T) {
+	input := "def down(n) = ? <= n 0 0 + 1 down(- n 1) ;; down(60)"
+	program := compile(t, "prefix", input)
+
+	vm := NewVM()
+	vm.MaxDepth = 50
+	if err := vm.Execute(program); err == nil {
+		t.Errorf("Expected the recursion limit to be exceeded for input `%s`.", input)
+	}
+	vm.MaxDepth = 100
+	if err := vm.Execute(program); err != nil {
+		t.Errorf("Execution error for input `%s`: %v", input, err)
+	}
+}
+
+func TestProcessLetBindings(t *testing.T) {
+	tests := []struct {
+		input string
+		want  interface{}
+	}{
+		{"let x = 3 in * x x", big.NewInt(9)},
+		{"x = 5 ;; + let x = 2 in * x x x", big.NewInt(9)},
+		{"let a = 2 in let b = + a 1 in * a b", big.NewInt(6)},
+		{"let x = 1 in let x = + x 1 in x", big.NewInt(2)},
+		{"f = let k = 3 in fn(x) * x k ;; f(2)", big.NewInt(6)},
+		{"def loop(n) = let m = - n 1 in ? <= m 0 0 loop(m) ;; loop(5000)", big.NewInt(0)},
+	}
+
+	for _, tt := range tests {
+		expect(t, tt.input, top(run(t, tt.input)), tt.want)
+	}
+}
+
+func TestLetBindingsDoNotLeak(t *testing.T) {
+	vm := NewVM()
+	for _, input := range []string{"let tmp = 3 in tmp", "tmp"} {
+		err := vm.Execute(compile(t, "prefix", input))
+		if input == "tmp" && err == nil {
+			t.Errorf("The `let` binding leaked into the global variables.")
+		} else if input != "tmp" && err != nil {
+			t.Fatalf("Execution error for input `%s`: %v", input, err)
 		}
 	}
 }
 
-func TestProcessBinaryOperations(t *testing.T) {
+func TestProcessNumberNotations(t *testing.T) {
+	tests := []struct {
+		options []Option
+		input   string
+		want    interface{}
+	}{
+		{nil, "1e-9", 1e-9},
+		{nil, "2.5E3", 2500.0},
+		{nil, "0xFF", big.NewInt(255)},
+		{nil, "- 0b1010 0o17", big.NewInt(-5)},
+		{nil, "1_000_000", big.NewInt(1000000)},
+		{nil, "0x1_F", big.NewInt(31)},
+		{nil, "0xFFFF_FFFF_FFFF_FFFF_FF", new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 72), big.NewInt(1))},
+		{nil, "| 0b1100 0o3", big.NewInt(15)},
+		{[]Option{WithRational()}, "1e-3", big.NewRat(1, 1000)},
+	}
+
+	for _, tt := range tests {
+		expect(t, tt.input, top(run(t, tt.input, tt.options...)), tt.want)
+	}
+}
+
+func TestProcessMathSymbols(t *testing.T) {
 	tests := []struct {
 		input string
-		want  float64
+		want  interface{}
 	}{
-		{"- PI E", 0.423310825130748},
-		{"% - 50 10 2", 0},
+		{"√ 16", 4.0},
+		{"÷ × π 2 π", 2.0},
+		{"− 5 3", big.NewInt(2)},
+		{"√ -4", 2i},
+		{"∧ ≤ 1 2 ≠ 1 2", true},
+		{"¬ ≥ 1 2", true},
 	}
 
 	for _, tt := range tests {
-		l, err := parser.NewLexer(tt.input)
-		if err != nil {
-			t.Fatalf("Failed to tokenize input `%s`: %v", tt.input, err)
-			continue
+		expect(t, tt.input, top(run(t, tt.input)), tt.want)
+	}
+}
+
+func TestProcessBigFloatMode(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"fact(25)", "15511210043330985984000000"},
+		{"+ 0.1 0.2", "0.3"},
+		{"/ 1 3", "0.33333333333333333333333333333333333"},
+		{"^ 2 100", "1267650600228229401496703205376"},
+		{"^ 2 0.5", "1.4142135623730950488016887242096981"},
+		{"% 10 3", "1"},
+		{"PI", "3.1415926535897932384626433832795029"},
+		{"max(1, / 5 2, 2)", "2.5"},
+		{"- 0 ! fact(3)", "-720"},
+		{"integ(fn(x) * x x, 0, 3)", "9"},
+		{"? > / 1 3 0.3333 1 2", "1"},
+	}
+
+	for _, tt := range tests {
+		expect(t, tt.input, run(t, tt.input, WithBigFloat(128)).String(), tt.want)
+	}
+}
+
+func TestBigFloatInfinityErrors(t *testing.T) {
+	for _, input := range []string{"% ^ 10 1000000000 3", "// ^ 10 1000000000 3"} {
+		if err := NewVM(WithBigFloat(128)).Execute(compile(t, "prefix", input)); err == nil {
+			t.Errorf("Expected an error for input `%s`.", input)
 		}
-		p, err := parser.NewParser(l.Tokens)
-		if err != nil {
-			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", tt.input, err)
-			continue
+	}
+}
+
+func TestFactorialDoesNotOverflow(t *testing.T) {
+	got, err := Factorial(25.0)
+	if err != nil {
+		t.Fatalf("Factorial failed: %v", err)
+	} else if want := 1.5511210043330986e+25; got != want {
+		t.Errorf("Factorial overflowed! Got `%v`, want `%v`.", got, want)
+	}
+}
+
+func TestLargeFactorials(t *testing.T) {
+	if got, err := Factorial(1e12); err != nil || !math.IsInf(got.(float64), 1) {
+		t.Errorf("Expected `+Inf`, got `%v` (%v)!", got, err)
+	}
+
+	want := "Factorial of 1000000000000 is too large to compute!"
+	for _, n := range []interface{}{big.NewFloat(1e12), big.NewInt(1e12), big.NewRat(1e12, 1)} {
+		if _, err := Factorial(n); err == nil || err.Error() != want {
+			t.Errorf("Expected `%s`, got `%v`!", want, err)
 		}
-		g := parser.NewBytecodeGenerator(p.Nodes)
-		vm := NewVM()
-		if err := vm.Execute(g.Bytecode); err != nil {
-			t.Fatalf("Execution error for input `%s`: %v", tt.input, err)
-		} else if got := vm.Stack[len(vm.Stack)-1]; !reflect.DeepEqual(got, tt.want) {
-			t.Errorf(
-				"The execution output does not match the expectations! Input `%s`, got `%v`, want `%v`.",
-				tt.input,
-				got,
-				tt.want,
-			)
+	}
+}
+
+func TestProcessRationalMode(t *testing.T) {
+	tests := []struct {
+		input    string
+		decimals int
+		want     string
+	}{
+		{"/ 1 3", 0, "1/3"},
+		{"+ / 1 3 / 1 6", 0, "1/2"},
+		{"+ 0.1 0.2", 0, "3/10"},
+		{"^ / 2 3 -2", 0, "9/4"},
+		{"% / 7 2 1", 0, "1/2"},
+		{"fact(25)", 0, "15511210043330985984000000"},
+		{"sum(i, 1, 4, / 1 i)", 0, "25/12"},
+		{"integ(fn(x) * x x, 0, 3)", 0, "9"},
+		{"== + 0.1 0.2 0.3", 0, "true"},
+		{"/ 2 3", 4, "0.6667"},
+		{"/ 1 4", 4, "0.25"},
+		{"^ 4 0.5", 0, "2"},
+	}
+
+	for _, tt := range tests {
+		vm := NewVM(WithRational())
+		vm.Decimals = tt.decimals
+		execute(t, vm, compile(t, "prefix", tt.input), tt.input)
+		expect(t, tt.input, vm.String(), tt.want)
+	}
+}
+
+func TestExponentLimit(t *testing.T) {
+	tests := []struct {
+		input   string
+		options []Option
+		want    string
+	}{
+		{"^ 2 1000000000000", []Option{WithRational()}, "Exponent too large: 1000000000000"},
+		{"^ 2 -1000000000000", []Option{WithRational()}, "Exponent too large: -1000000000000"},
+		{"^ / 1 ^ 2 20000 1000000", []Option{WithRational()}, "The result of `POW` is too large!"},
+		{"^ ^ 2 20000 -1000000", []Option{WithRational()}, "The result of `POW` is too large!"},
+		{"^ 2 1000000000000", nil, "Exponent too large: 1000000000000"},
+		{"^ ^ 2 20000 1000000", nil, "The result of `POW` is too large!"},
+		{"^ 1 km 100000000", nil, "Exponent too large: 100000000"},
+		{"^ 1 mi -1000000", nil, "The result of `POW` is too large!"},
+		{"round(1, 100000000)", nil, "Too many decimal places: 100000000"},
+		{"round(1, -1)", nil, "The decimal places must be a non-negative integer, got `-1`!"},
+		{"^ 2 1000000000000", []Option{WithDecimal(2, HalfEven)}, "Exponent too large: 1000000000000"},
+	}
+
+	for _, tt := range tests {
+		if err := NewVM(tt.options...).Execute(compile(t, "prefix", tt.input)); err == nil || err.Error() != tt.want {
+			t.Errorf("Expected `%s` for input `%s`, got `%v`!", tt.want, tt.input, err)
 		}
 	}
 }
 
-func TestProcessVariableDeclaration(t *testing.T) {
+func TestProcessIntegers(t *testing.T) {
 	tests := []struct {
 		input string
-		want  float64
+		want  interface{}
 	}{
-		{"x = 10", 10},
-		{"y = x", 10},
+		{"^ 2 70", new(big.Int).Lsh(big.NewInt(1), 70)},
+		{"* 99999999999999999 10", big.NewInt(999999999999999990)},
+		{"+ << 1 70 1", new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), 70), big.NewInt(1))},
+		{"// 7 2", big.NewInt(3)},
+		{"% -7 2", big.NewInt(-1)},
+		{"/ 7 2", 3.5},
+		{"+ 1 2.5", 3.5},
+		{"& 12 10", big.NewInt(8)},
+		{"| 12 10", big.NewInt(14)},
+		{"xor 12 10", big.NewInt(6)},
+		{"~ 5", big.NewInt(-6)},
+		{">> << 1 100 98", big.NewInt(4)},
+		{"fact(21)", big.NewInt(0).MulRange(1, 21)},
+		{"== & 6 3 2", true},
 	}
 
-	vm := NewVM() // To keep the variable in the next rounds
 	for _, tt := range tests {
-		l, err := parser.NewLexer(tt.input)
-		if err != nil {
-			t.Fatalf("Failed to tokenize input `%s`: %v", tt.input, err)
-			continue
+		expect(t, tt.input, top(run(t, tt.input)), tt.want)
+	}
+}
+
+func TestBitwiseOperationsRequireIntegers(t *testing.T) {
+	for _, input := range []string{"& 1.5 1", "~ true", "<< 1 -1"} {
+		if err := NewVM().Execute(compile(t, "prefix", input)); err == nil {
+			t.Errorf("Expected an error for input `%s`.", input)
 		}
-		p, err := parser.NewParser(l.Tokens)
-		if err != nil {
-			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", tt.input, err)
-			continue
+	}
+}
+
+func TestProcessComplexNumbers(t *testing.T) {
+	tests := []struct {
+		input string
+		want  interface{}
+	}{
+		{"+ 3 4i", complex(3, 4)},
+		{"* i i", -1.0},
+		{"^ -4 0.5", complex(0, 2)},
+		{"/ + 1 i - 1 i", complex(0, 1)},
+		{"^ + 1 i 2", complex(0, 2)},
+		{"re(+ 3 4i)", 3.0},
+		{"im(+ 3 4i)", 4.0},
+		{"conj(+ 3 4i)", complex(3, -4)},
+		{"abs(+ 3 4i)", 5.0},
+		{"arg(-1)", math.Pi},
+		{"polar(2, 0)", 2.0},
+		{"== i 1i", true},
+	}
+
+	for _, tt := range tests {
+		expect(t, tt.input, top(run(t, tt.input)), tt.want)
+	}
+}
+
+func TestComplexNumbersAreNotOrdered(t *testing.T) {
+	for _, input := range []string{"< i 1", "% i 2", "max(i, 1)"} {
+		if err := NewVM().Execute(compile(t, "prefix", input)); err == nil {
+			t.Errorf("Expected an error for input `%s`.", input)
 		}
-		g := parser.NewBytecodeGenerator(p.Nodes)
-		if err := vm.Execute(g.Bytecode); err != nil {
-			t.Fatalf("Execution error for input `%s`: %v", tt.input, err)
-		} else if got := vm.Stack[len(vm.Stack)-1]; !reflect.DeepEqual(got, tt.want) {
-			t.Errorf(
-				"The execution output does not match the expectations! Input `%s`, got `%v`, want `%v`.",
-				tt.input,
-				got,
-				tt.want,
-			)
+	}
+}
+
+func TestProcessQuantities(t *testing.T) {
+	tests := []struct {
+		input    string
+		notation string
+		want     string
+	}{
+		{"/ 3 m 2 s", "prefix", "1.5 m/s"},
+		{"3 m / 2 s", "infix", "1.5 m/s"},
+		{"3 m / 2 s to km / h", "infix", "5.4 km/h"},
+		{"+ 1 km 300 m", "prefix", "1.3 km"},
+		{"to 1 mi ft", "prefix", "5280 ft"},
+		{"/ 1 km 1 m", "prefix", "1000"},
+		{"^ ^ 3 m 2 0.5", "prefix", "3 m"},
+		{"< 1 ft 1 m", "prefix", "true"},
+		{"s = 4 ;; * 2 (s)", "prefix", "8"},
+		{"* 3 m / 2 s", "prefix", "6 m/s"},
+		{"def f(s) = * 2 s ;; f(4)", "prefix", "8"},
+		{"let g = 3 in * 2 g", "prefix", "6"},
+		{"m = 5 ;; * 2 m", "prefix", "10"},
+		{"sum(s, 1, 3, * 2 s)", "prefix", "12"},
+		{"def f(s) = + * 2 s 1 ;; f(4)", "prefix", "9"},
+		{"def f(s) = 2 * s ;; f(4)", "infix", "8"},
+		{"def f(h) = 2 h * ;; f(4)", "postfix", "8"},
+		{"3 m 2 m + km to", "postfix", "0.005 km"},
+	}
+
+	for _, tt := range tests {
+		vm := NewVM()
+		execute(t, vm, compile(t, tt.notation, tt.input), tt.input)
+		expect(t, tt.input, vm.String(), tt.want)
+	}
+}
+
+func TestDimensionErrors(t *testing.T) {
+	for _, input := range []string{"+ 3 m 2 s", "to 1 m s", "< 1 m 1 kg", "^ 2 m 0.3", "+ 1 m 1"} {
+		if err := NewVM().Execute(compile(t, "prefix", input)); err == nil {
+			t.Errorf("Expected a dimension error for input `%s`.", input)
+		}
+	}
+}
+
+func TestProcessDecimalMode(t *testing.T) {
+	tests := []struct {
+		input    string
+		places   int
+		rounding Rounding
+		want     string
+	}{
+		{"+ 0.1 0.2", 2, HalfEven, "0.30"},
+		{"/ 10 3", 2, HalfEven, "3.33"},
+		{"* 19.99 3", 2, HalfEven, "59.97"},
+		{"+ 1.005 0", 2, HalfEven, "1.00"},
+		{"+ 1.015 0", 2, HalfEven, "1.02"},
+		{"+ 1.005 0", 2, HalfUp, "1.01"},
+		{"- -1.005 0", 2, HalfUp, "-1.01"},
+		{"/ 2 3", 2, Down, "0.66"},
+		{"/ -2 3", 2, Down, "-0.66"},
+		{"/ 1 3", 2, Ceiling, "0.34"},
+		{"/ -1 3", 2, Ceiling, "-0.33"},
+		{"round(/ 10 3, 1)", 4, HalfEven, "3.3"},
+		{"round(2.3456, 2, halfUp)", 4, HalfEven, "2.35"},
+		{"round(2.345, 2, halfEven)", 4, HalfUp, "2.34"},
+		{"round(2.341, 2, ceiling)", 4, HalfEven, "2.35"},
+		{"round(2.349, 2, down)", 4, HalfEven, "2.34"},
+		{"round(2.345, 2, halfUp)", 2, HalfEven, "2.35"},
+		{"2.345", 2, HalfEven, "2.345"},
+		{"1.5", 2, HalfEven, "1.50"},
+		{"* 2.345 1", 2, HalfEven, "2.34"},
+		{"fact(5)", 2, HalfEven, "120.00"},
+		{"% 10 3", 2, HalfEven, "1.00"},
+	}
+
+	for _, tt := range tests {
+		expect(t, tt.input, run(t, tt.input, WithDecimal(tt.places, tt.rounding)).String(), tt.want)
+	}
+}
+
+func TestRoundInFloatMode(t *testing.T) {
+	vm := NewVM()
+	got, err := vm.Round(2.5, 0.0, HalfEven)
+	if err != nil {
+		t.Fatalf("Round failed: %v", err)
+	} else if got != 2.0 {
+		t.Errorf("Expected 2.5 to round half-even to 2, got `%v`.", got)
+	}
+	if _, err := vm.Round(2.5, 0.0, 1.0); err == nil {
+		t.Errorf("Expected an error for a number given as the rounding mode.")
+	}
+}
+
+func TestProcessConstantPool(t *testing.T) {
+	input := "def f(n) = * n 2.5 ;; + f(2) 2.5"
+	program := compile(t, "prefix", input)
+
+	// The same compiled program gives the numbers of each mode.
+	tests := []struct {
+		options []Option
+		want    interface{}
+	}{
+		{nil, 7.5},
+		{[]Option{WithRational()}, big.NewRat(15, 2)},
+		{[]Option{WithDecimal(2, HalfEven)}, Decimal{Coef: big.NewInt(750), Scale: 2, Rounding: HalfEven}},
+	}
+
+	for _, tt := range tests {
+		vm := NewVM(tt.options...)
+		execute(t, vm, program, input)
+		expect(t, input, top(vm), tt.want)
+	}
+
+	// Too large for a float, but not for a big float.
+	huge, err := bytecode.ParseConstant("1e400")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	program = bytecode.Program{Constants: []bytecode.Constant{huge}, Code: []bytecode.Instruction{{Op: bytecode.PUSH_CONST}}}
+	if err := NewVM(WithBigFloat(DefaultPrecision)).Execute(program); err != nil {
+		t.Errorf("Execution error: %v", err)
+	}
+	if err := NewVM().Execute(program); err == nil || err.Error() != "Invalid number: 1e400" {
+		t.Errorf("Expected `Invalid number: 1e400`, got `%v`!", err)
+	}
+}
+
+func TestGlobalsAreLinkedAcrossPrograms(t *testing.T) {
+	tests := []struct {
+		input string
+		want  interface{}
+	}{
+		{"a = 1 ;; b = 2", big.NewInt(2)},
+		{"c = 10 ;; + b c", big.NewInt(12)},
+		{"def f(x) = + x a ;; f(c)", big.NewInt(11)},
+		{"a = 5 ;; f(b)", big.NewInt(7)},
+		{"let add = fn(x, y) + x y in add(a, b)", big.NewInt(7)},
+		{"s = 3", big.NewInt(3)},
+		{"+ * 2 s 1", big.NewInt(7)},
+	}
+
+	// Each line is compiled on its own and numbers its globals differently,
+	// while the names assigned on earlier lines still hide units.
+	vm := NewVM()
+	for _, tt := range tests {
+		execute(t, vm, compile(t, "prefix", tt.input, parser.WithVariables(vm.Variables())), tt.input)
+		expect(t, tt.input, top(vm), tt.want)
+	}
+
+	if want := []string{"a", "b", "c", "f", "s"}; !reflect.DeepEqual(vm.Symbols.Names, want) {
+		t.Errorf("Expected the globals %v, got %v!", want, vm.Symbols.Names)
+	}
+}
+
+func TestUndefinedVariables(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"+ 1 nope", "Undefined variable: nope"},
+		{"nope(1)", "Undefined variable: nope"},
+		{"x = 1 ;; x(2)", "`x` is not callable!"},
+	}
+
+	for _, tt := range tests {
+		if err := NewVM().Execute(compile(t, "prefix", tt.input)); err == nil || err.Error() != tt.want {
+			t.Errorf("Expected `%s` for input `%s`, got `%v`!", tt.want, tt.input, err)
 		}
 	}
 }
+
+func TestProcessDecodedPrograms(t *testing.T) {
+	input := "def sq(x) = * x x ;; sq(+ 1_000 0.5)"
+	l, err := parser.NewLexer(input)
+	if err != nil {
+		t.Fatalf("Failed to tokenize input `%s`: %v", input, err)
+	}
+	p, err := parser.NewParser(l.Tokens)
+	if err != nil {
+		t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", input, err)
+	}
+	data, err := bytecode.Encode(parser.NewBytecodeGenerator(p.Nodes, parser.WithPositions(p.Positions)).Program())
+	if err != nil {
+		t.Fatalf("Failed to encode the program: %v", err)
+	}
+
+	// The compiled program is run without the parser, in any mode.
+	program, err := bytecode.Decode(data)
+	if err != nil {
+		t.Fatalf("Failed to decode the program: %v", err)
+	}
+	tests := []struct {
+		options []Option
+		want    interface{}
+	}{
+		{nil, 1001000.25},
+		{[]Option{WithRational()}, big.NewRat(4004001, 4)},
+	}
+	for _, tt := range tests {
+		vm := NewVM(tt.options...)
+		execute(t, vm, program, input)
+		expect(t, input, top(vm), tt.want)
+	}
+}
+
+func TestProcessAssembledPrograms(t *testing.T) {
+	// Counts down from 3 with a hand-written loop, which the compiler never
+	// generates.
+	program, err := bytecode.Assemble(`
+CONST 3
+CONST 1
+PUSH_CONST 0
+STORE_GLOBAL n
+loop:
+LOAD_GLOBAL n
+PUSH_CONST 1
+COMPARE LT
+JUMP_IF_TRUE done
+LOAD_GLOBAL n
+PUSH_CONST 1
+BINARY_OP SUB
+STORE_GLOBAL n
+JUMP loop
+done:
+LOAD_GLOBAL n
+`)
+	if err != nil {
+		t.Fatalf("Failed to assemble the program: %v", err)
+	}
+
+	vm := NewVM()
+	if err := vm.Execute(program); err != nil {
+		t.Fatalf("Execution error: %v", err)
+	} else if got, ok := vm.Stack[len(vm.Stack)-1].(*big.Int); !ok || got.Sign() != 0 {
+		t.Errorf("The execution output does not match the expectations! Got `%v`, want `%v`.", vm.Stack[len(vm.Stack)-1], 0)
+	}
+}
+
+func TestUnassignedLocals(t *testing.T) {
+	program, err := bytecode.Assemble(`
+PUSH_SCOPE 1
+LOAD_LOCAL 0 0 x
+LOAD_GLOBAL min
+CALL_FUNC min 1
+`)
+	if err != nil {
+		t.Fatalf("Failed to assemble the program: %v", err)
+	}
+
+	want := "Undefined variable: x"
+	if err := NewVM().Execute(program); err == nil || err.Error() != want {
+		t.Errorf("Expected `%s`, got `%v`!", want, err)
+	}
+}
@@ -2,30 +2,282 @@ package parser
 
 import (
 	"fmt"
-	"strings"
+
+	"github.com/sheikhartin/bytecode-based-calculator/pkg/bytecode"
 )
 
 type BytecodeGenerator struct {
-	ast      []ASTNode
-	Bytecode []string
+	ast       []ASTNode
+	labels    map[string]int
+	jumps     map[int]string
+	numLabels int
+	pool      *bytecode.ConstantPool
+	symbols   *bytecode.SymbolTable
+	sources   map[ASTNode]Position
+	pos       bytecode.Position
+	Bytecode  []bytecode.Instruction
+	Positions []bytecode.Position
+}
+
+type GeneratorOption func(*BytecodeGenerator)
+
+// WithPositions takes where each node starts in the source, usually the
+// positions of a parser, and records them as debug information for every
+// instruction generated from the node. An instruction gets the position of
+// the innermost node it is generated for.
+func WithPositions(positions map[ASTNode]Position) GeneratorOption {
+	return func(g *BytecodeGenerator) {
+		g.sources = positions
+		g.Positions = []bytecode.Position{}
+	}
 }
 
 func (g BytecodeGenerator) String() string {
-	return strings.Join(g.Bytecode, "\n")
+	return g.Program().String()
+}
+
+// Lines renders every instruction in the textual form shown by `-g`.
+func (g BytecodeGenerator) Lines() []string {
+	lines := make([]string, len(g.Bytecode))
+	for i, ins := range g.Bytecode {
+		lines[i] = ins.String()
+	}
+	return lines
+}
+
+// Every instruction goes through emit or emitBody, which keep the positions in
+// step with the bytecode when they are recorded.
+func (g *BytecodeGenerator) emit(instructions ...bytecode.Instruction) {
+	g.Bytecode = append(g.Bytecode, instructions...)
+	if g.Positions != nil {
+		for range instructions {
+			g.Positions = append(g.Positions, g.pos)
+		}
+	}
+}
+
+func (g *BytecodeGenerator) emitBody(b *BytecodeGenerator) {
+	g.Bytecode = append(g.Bytecode, b.Bytecode...)
+	if g.Positions != nil {
+		g.Positions = append(g.Positions, b.Positions...)
+	}
+}
+
+func (g *BytecodeGenerator) Emit(op bytecode.Opcode) {
+	g.emit(bytecode.Instruction{Op: op})
+}
+
+func (g *BytecodeGenerator) EmitName(op bytecode.Opcode, name string) {
+	g.emit(bytecode.Instruction{Op: op, Name: name})
+}
+
+var operators = map[TokenKind]bytecode.Operator{
+	ADD:  bytecode.ADD,
+	SUB:  bytecode.SUB,
+	MUL:  bytecode.MUL,
+	DIV:  bytecode.DIV,
+	IDIV: bytecode.IDIV,
+	MOD:  bytecode.MOD,
+	POW:  bytecode.POW,
+	FACT: bytecode.FACT,
+	NOT:  bytecode.NOT,
+	SQRT: bytecode.SQRT,
+	LT:   bytecode.LT,
+	LE:   bytecode.LE,
+	GT:   bytecode.GT,
+	GE:   bytecode.GE,
+	EQ:   bytecode.EQ,
+	NE:   bytecode.NE,
+	BAND: bytecode.BAND,
+	BOR:  bytecode.BOR,
+	BXOR: bytecode.BXOR,
+	BNOT: bytecode.BNOT,
+	SHL:  bytecode.SHL,
+	SHR:  bytecode.SHR,
 }
 
-func (g *BytecodeGenerator) Emit(op string, operands ...string) {
-	g.Bytecode = append(g.Bytecode, fmt.Sprintf("%s\t%s", op, strings.Join(operands, "\t")))
+// Operators are emitted with the operator of their token, which the VM
+// switches on directly.
+func (g *BytecodeGenerator) EmitOperator(op bytecode.Opcode, kind TokenKind) {
+	g.emit(bytecode.Instruction{Op: op, Operator: operators[kind]})
+}
+
+// Number literals are parsed here, once, and kept in the constant pool. One
+// that cannot be parsed is still pooled so that validating the program reports
+// it before anything runs.
+func (g *BytecodeGenerator) EmitConstant(text string) {
+	c, err := bytecode.ParseConstant(text)
+	if err != nil {
+		c = bytecode.Constant{Text: text}
+	}
+	g.emit(bytecode.Instruction{Op: bytecode.PUSH_CONST, Arg: g.pool.Add(c)})
+}
+
+// Identifiers are addressed by the slots the resolver bound them to.
+func (g *BytecodeGenerator) EmitSlot(op bytecode.Opcode, ident IdentifierNode) {
+	g.emit(bytecode.Instruction{
+		Op:    op,
+		Name:  ident.Value,
+		Arg:   ident.Binding.Slot,
+		Depth: ident.Binding.Depth,
+	})
+}
+
+func (g *BytecodeGenerator) EmitLoad(ident IdentifierNode) {
+	if ident.Binding.Local {
+		g.EmitSlot(bytecode.LOAD_LOCAL, ident)
+	} else {
+		g.EmitSlot(bytecode.LOAD_GLOBAL, ident)
+	}
+}
+
+func (g *BytecodeGenerator) EmitStore(ident IdentifierNode) {
+	if ident.Binding.Local {
+		g.EmitSlot(bytecode.STORE_LOCAL, ident)
+	} else {
+		g.EmitSlot(bytecode.STORE_GLOBAL, ident)
+	}
+}
+
+func (g *BytecodeGenerator) EmitScope(size int) {
+	g.emit(bytecode.Instruction{Op: bytecode.PUSH_SCOPE, Arg: size})
+}
+
+func (g *BytecodeGenerator) EmitBool(value bool) {
+	ins := bytecode.Instruction{Op: bytecode.PUSH_BOOL}
+	if value {
+		ins.Arg = 1
+	}
+	g.emit(ins)
+}
+
+func (g *BytecodeGenerator) EmitCall(name string, argCount int) {
+	g.emit(bytecode.Instruction{Op: bytecode.CALL_FUNC, Name: name, Arg: argCount})
+}
+
+// A function body directly follows the instruction that creates the function,
+// which only records its size; an empty name makes an anonymous closure.
+func (g *BytecodeGenerator) EmitFunction(name string, params []*IdentifierNode, body ExprNode) {
+	b := newBytecodeGenerator([]ASTNode{body}, g.pool, g.symbols, func(b *BytecodeGenerator) {
+		b.sources, b.pos = g.sources, g.pos
+		if g.Positions != nil {
+			b.Positions = []bytecode.Position{}
+		}
+	})
+	b.Emit(bytecode.RETURN)
+	b.markTailCalls()
+
+	ins := bytecode.Instruction{Op: bytecode.MAKE_FUNC, Name: name, Arg: len(b.Bytecode)}
+	if name == "" {
+		ins.Op = bytecode.MAKE_CLOSURE
+	}
+	for _, param := range params {
+		ins.Params = append(ins.Params, param.Value)
+	}
+	g.emit(ins)
+	g.emitBody(b)
+}
+
+func (g *BytecodeGenerator) NewLabel() string {
+	g.numLabels++
+	return fmt.Sprintf("L%d", g.numLabels)
+}
+
+func (g *BytecodeGenerator) MarkLabel(label string) {
+	g.labels[label] = len(g.Bytecode)
+}
+
+func (g *BytecodeGenerator) EmitJump(op bytecode.Opcode, label string) {
+	g.jumps[len(g.Bytecode)] = label
+	g.Emit(op)
+}
+
+func (g *BytecodeGenerator) resolveLabels() {
+	for i, label := range g.jumps {
+		g.Bytecode[i].Arg = g.labels[label]
+	}
+	g.jumps = map[int]string{}
+}
+
+// A call is in tail position when nothing but scope cleanup and jumps stand
+// between it and the `RETURN` of its function.
+func (g *BytecodeGenerator) returnsFrom(i int) bool {
+	for steps := 0; i < len(g.Bytecode) && steps < len(g.Bytecode); steps++ {
+		switch ins := g.Bytecode[i]; ins.Op {
+		case bytecode.RETURN:
+			return true
+		case bytecode.POP_SCOPE:
+			i++
+		case bytecode.JUMP:
+			i = ins.Arg
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+func (g *BytecodeGenerator) markTailCalls() {
+	for i := 0; i < len(g.Bytecode); i++ {
+		switch g.Bytecode[i].Op {
+		case bytecode.MAKE_FUNC, bytecode.MAKE_CLOSURE:
+			i += g.Bytecode[i].Arg
+		case bytecode.CALL_FUNC:
+			if g.returnsFrom(i + 1) {
+				g.Bytecode[i].Op = bytecode.TAIL_CALL
+			}
+		}
+	}
+}
+
+// The position of a node holds while it is generated, and the one of its
+// parent takes over again after it.
+func (g *BytecodeGenerator) generateNode(node ASTNode) {
+	if pos, ok := g.sources[node]; ok {
+		outer := g.pos
+		g.pos = bytecode.Position{Line: pos.Row, Column: pos.Col}
+		defer func() { g.pos = outer }()
+	}
+	node.GenerateBytecode(g)
 }
 
 func (g *BytecodeGenerator) Generate() {
 	for _, node := range g.ast {
-		node.GenerateBytecode(g)
+		g.generateNode(node)
+	}
+	g.resolveLabels()
+}
+
+// Program pairs the generated bytecode with the constants and global slots it
+// refers to.
+func (g *BytecodeGenerator) Program() bytecode.Program {
+	return bytecode.Program{
+		Constants: g.pool.Constants,
+		Symbols:   g.symbols.Names,
+		Code:      g.Bytecode,
+		Positions: g.Positions,
 	}
 }
 
-func NewBytecodeGenerator(ast []ASTNode) *BytecodeGenerator {
-	g := &BytecodeGenerator{ast: ast}
+// The identifiers are resolved to their slots first, then the bytecode is
+// generated from the resolved tree.
+func NewBytecodeGenerator(ast []ASTNode, options ...GeneratorOption) *BytecodeGenerator {
+	r := NewResolver(ast)
+	return newBytecodeGenerator(ast, &bytecode.ConstantPool{}, &r.Symbols, options...)
+}
+
+// Function bodies are generated separately but share the pool and the symbol
+// table of the program.
+func newBytecodeGenerator(
+	ast []ASTNode,
+	pool *bytecode.ConstantPool,
+	symbols *bytecode.SymbolTable,
+	options ...GeneratorOption,
+) *BytecodeGenerator {
+	g := &BytecodeGenerator{ast: ast, labels: map[string]int{}, jumps: map[int]string{}, pool: pool, symbols: symbols}
+	for _, option := range options {
+		option(g)
+	}
 	g.Generate()
 	return g
 }
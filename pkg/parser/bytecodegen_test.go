@@ -2,7 +2,10 @@ package parser
 
 import (
 	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/sheikhartin/bytecode-based-calculator/pkg/bytecode"
 )
 
 func TestGenerateBytecodeForNumbers(t *testing.T) {
@@ -10,8 +13,8 @@ func TestGenerateBytecodeForNumbers(t *testing.T) {
 		input string
 		want  []string
 	}{
-		{"358", []string{"PUSH_NUM\t358"}},
-		{"2.7182", []string{"PUSH_NUM\t2.7182"}},
+		{"358", []string{"PUSH_CONST\t0"}},
+		{"2.7182", []string{"PUSH_CONST\t0"}},
 	}
 
 	for _, tt := range tests {
@@ -26,8 +29,8 @@ func TestGenerateBytecodeForNumbers(t *testing.T) {
 			continue
 		}
 		g := NewBytecodeGenerator(p.Nodes)
-		if !reflect.DeepEqual(g.Bytecode, tt.want) {
-			t.Errorf("Failed to generate bytecode. Got `%v`, expected `%v`.", g.Bytecode, tt.want)
+		if !reflect.DeepEqual(g.Lines(), tt.want) {
+			t.Errorf("Failed to generate bytecode. Got `%v`, expected `%v`.", g.Lines(), tt.want)
 		}
 	}
 }
@@ -37,9 +40,9 @@ func TestGenerateBytecodeForCalls(t *testing.T) {
 		input string
 		want  []string
 	}{
-		{"func()", []string{"CALL_FUNC\tfunc\t0"}},
-		{"func(22)", []string{"PUSH_NUM\t22", "CALL_FUNC\tfunc\t1"}},
-		{"func(x, y,)", []string{"LOAD_VAR\tx", "LOAD_VAR\ty", "CALL_FUNC\tfunc\t2"}},
+		{"func()", []string{"LOAD_GLOBAL\t0\tfunc", "CALL_FUNC\tfunc\t0"}},
+		{"func(22)", []string{"PUSH_CONST\t0", "LOAD_GLOBAL\t0\tfunc", "CALL_FUNC\tfunc\t1"}},
+		{"func(x, y,)", []string{"LOAD_GLOBAL\t0\tx", "LOAD_GLOBAL\t1\ty", "LOAD_GLOBAL\t2\tfunc", "CALL_FUNC\tfunc\t2"}},
 	}
 
 	for _, tt := range tests {
@@ -54,8 +57,8 @@ func TestGenerateBytecodeForCalls(t *testing.T) {
 			continue
 		}
 		g := NewBytecodeGenerator(p.Nodes)
-		if !reflect.DeepEqual(g.Bytecode, tt.want) {
-			t.Errorf("Failed to generate bytecode. Got `%v`, expected `%v`.", g.Bytecode, tt.want)
+		if !reflect.DeepEqual(g.Lines(), tt.want) {
+			t.Errorf("Failed to generate bytecode. Got `%v`, expected `%v`.", g.Lines(), tt.want)
 		}
 	}
 }
@@ -65,8 +68,8 @@ func TestGenerateBytecodeForUnaryOperations(t *testing.T) {
 		input string
 		want  []string
 	}{
-		{"! 6", []string{"PUSH_NUM\t6", "UNARY_OP\tFACT"}},
-		{"! ! 3", []string{"PUSH_NUM\t3", "UNARY_OP\tFACT", "UNARY_OP\tFACT"}},
+		{"! 6", []string{"PUSH_CONST\t0", "UNARY_OP\tFACT"}},
+		{"! ! 3", []string{"PUSH_CONST\t0", "UNARY_OP\tFACT", "UNARY_OP\tFACT"}},
 	}
 
 	for _, tt := range tests {
@@ -81,8 +84,8 @@ func TestGenerateBytecodeForUnaryOperations(t *testing.T) {
 			continue
 		}
 		g := NewBytecodeGenerator(p.Nodes)
-		if !reflect.DeepEqual(g.Bytecode, tt.want) {
-			t.Errorf("Failed to generate bytecode. Got `%v`, expected `%v`.", g.Bytecode, tt.want)
+		if !reflect.DeepEqual(g.Lines(), tt.want) {
+			t.Errorf("Failed to generate bytecode. Got `%v`, expected `%v`.", g.Lines(), tt.want)
 		}
 	}
 }
@@ -92,8 +95,212 @@ func TestGenerateBytecodeForBinaryOperations(t *testing.T) {
 		input string
 		want  []string
 	}{
-		{"% 25 5", []string{"PUSH_NUM\t25", "PUSH_NUM\t5", "BINARY_OP\tMOD"}},
-		{"* 1 ! 0", []string{"PUSH_NUM\t1", "PUSH_NUM\t0", "UNARY_OP\tFACT", "BINARY_OP\tMUL"}},
+		{"% 25 5", []string{"PUSH_CONST\t0", "PUSH_CONST\t1", "BINARY_OP\tMOD"}},
+		{"* 1 ! 0", []string{"PUSH_CONST\t0", "PUSH_CONST\t1", "UNARY_OP\tFACT", "BINARY_OP\tMUL"}},
+	}
+
+	for _, tt := range tests {
+		l, err := NewLexer(tt.input)
+		if err != nil {
+			t.Fatalf("Failed to tokenize input `%s`: %v", tt.input, err)
+			continue
+		}
+		p, err := NewParser(l.Tokens)
+		if err != nil {
+			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", tt.input, err)
+			continue
+		}
+		g := NewBytecodeGenerator(p.Nodes)
+		if !reflect.DeepEqual(g.Lines(), tt.want) {
+			t.Errorf("Failed to generate bytecode. Got `%v`, expected `%v`.", g.Lines(), tt.want)
+		}
+	}
+}
+
+func TestGenerateBytecodeForFunctionDeclarations(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"def sq(x) = * x x", []string{
+			"MAKE_FUNC\tsq\t4\tx",
+			"LOAD_LOCAL\t0\t0\tx",
+			"LOAD_LOCAL\t0\t0\tx",
+			"BINARY_OP\tMUL",
+			"RETURN",
+			"STORE_GLOBAL\t0\tsq",
+		}},
+	}
+
+	for _, tt := range tests {
+		l, err := NewLexer(tt.input)
+		if err != nil {
+			t.Fatalf("Failed to tokenize input `%s`: %v", tt.input, err)
+			continue
+		}
+		p, err := NewParser(l.Tokens)
+		if err != nil {
+			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", tt.input, err)
+			continue
+		}
+		g := NewBytecodeGenerator(p.Nodes)
+		if !reflect.DeepEqual(g.Lines(), tt.want) {
+			t.Errorf("Failed to generate bytecode. Got `%v`, expected `%v`.", g.Lines(), tt.want)
+		}
+	}
+}
+
+func TestGenerateBytecodeForConditionals(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"? x 1 2", []string{
+			"LOAD_GLOBAL\t0\tx",
+			"JUMP_IF_FALSE\t4",
+			"PUSH_CONST\t0",
+			"JUMP\t5",
+			"PUSH_CONST\t1",
+		}},
+		{"def f(n) = ? n 1 0", []string{
+			"MAKE_FUNC\tf\t6\tn",
+			"LOAD_LOCAL\t0\t0\tn",
+			"JUMP_IF_FALSE\t4",
+			"PUSH_CONST\t0",
+			"JUMP\t5",
+			"PUSH_CONST\t1",
+			"RETURN",
+			"STORE_GLOBAL\t0\tf",
+		}},
+	}
+
+	for _, tt := range tests {
+		l, err := NewLexer(tt.input)
+		if err != nil {
+			t.Fatalf("Failed to tokenize input `%s`: %v", tt.input, err)
+			continue
+		}
+		p, err := NewParser(l.Tokens)
+		if err != nil {
+			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", tt.input, err)
+			continue
+		}
+		g := NewBytecodeGenerator(p.Nodes)
+		if !reflect.DeepEqual(g.Lines(), tt.want) {
+			t.Errorf("Failed to generate bytecode. Got `%v`, expected `%v`.", g.Lines(), tt.want)
+		}
+	}
+}
+
+func TestGenerateBytecodeForLogicalOperations(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"< x 1", []string{"LOAD_GLOBAL\t0\tx", "PUSH_CONST\t0", "COMPARE\tLT"}},
+		{"and a b", []string{
+			"LOAD_GLOBAL\t0\ta",
+			"JUMP_IF_FALSE\t6",
+			"LOAD_GLOBAL\t1\tb",
+			"JUMP_IF_FALSE\t6",
+			"PUSH_BOOL\ttrue",
+			"JUMP\t7",
+			"PUSH_BOOL\tfalse",
+		}},
+		{"or a not b", []string{
+			"LOAD_GLOBAL\t0\ta",
+			"JUMP_IF_TRUE\t7",
+			"LOAD_GLOBAL\t1\tb",
+			"UNARY_OP\tNOT",
+			"JUMP_IF_TRUE\t7",
+			"PUSH_BOOL\tfalse",
+			"JUMP\t8",
+			"PUSH_BOOL\ttrue",
+		}},
+	}
+
+	for _, tt := range tests {
+		l, err := NewLexer(tt.input)
+		if err != nil {
+			t.Fatalf("Failed to tokenize input `%s`: %v", tt.input, err)
+			continue
+		}
+		p, err := NewParser(l.Tokens)
+		if err != nil {
+			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", tt.input, err)
+			continue
+		}
+		g := NewBytecodeGenerator(p.Nodes)
+		if !reflect.DeepEqual(g.Lines(), tt.want) {
+			t.Errorf("Failed to generate bytecode. Got `%v`, expected `%v`.", g.Lines(), tt.want)
+		}
+	}
+}
+
+func TestGenerateBytecodeForTailCalls(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"def f(n) = ? n f(- n 1) g(n)", []string{
+			"MAKE_FUNC\tf\t12\tn",
+			"LOAD_LOCAL\t0\t0\tn",
+			"JUMP_IF_FALSE\t8",
+			"LOAD_LOCAL\t0\t0\tn",
+			"PUSH_CONST\t0",
+			"BINARY_OP\tSUB",
+			"LOAD_GLOBAL\t0\tf",
+			"TAIL_CALL\tf\t1",
+			"JUMP\t11",
+			"LOAD_LOCAL\t0\t0\tn",
+			"LOAD_GLOBAL\t1\tg",
+			"TAIL_CALL\tg\t1",
+			"RETURN",
+			"STORE_GLOBAL\t0\tf",
+		}},
+		{"def f(n) = + 1 f(n)", []string{
+			"MAKE_FUNC\tf\t6\tn",
+			"PUSH_CONST\t0",
+			"LOAD_LOCAL\t0\t0\tn",
+			"LOAD_GLOBAL\t0\tf",
+			"CALL_FUNC\tf\t1",
+			"BINARY_OP\tADD",
+			"RETURN",
+			"STORE_GLOBAL\t0\tf",
+		}},
+		{"f(1)", []string{"PUSH_CONST\t0", "LOAD_GLOBAL\t0\tf", "CALL_FUNC\tf\t1"}},
+	}
+
+	for _, tt := range tests {
+		l, err := NewLexer(tt.input)
+		if err != nil {
+			t.Fatalf("Failed to tokenize input `%s`: %v", tt.input, err)
+			continue
+		}
+		p, err := NewParser(l.Tokens)
+		if err != nil {
+			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", tt.input, err)
+			continue
+		}
+		g := NewBytecodeGenerator(p.Nodes)
+		if !reflect.DeepEqual(g.Lines(), tt.want) {
+			t.Errorf("Failed to generate bytecode. Got `%v`, expected `%v`.", g.Lines(), tt.want)
+		}
+	}
+}
+
+func TestGenerateBytecodeForLetBindings(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"let x = 2 in x", []string{
+			"PUSH_CONST\t0",
+			"PUSH_SCOPE\t1",
+			"STORE_LOCAL\t0\t0\tx",
+			"LOAD_LOCAL\t0\t0\tx",
+			"POP_SCOPE",
+		}},
 	}
 
 	for _, tt := range tests {
@@ -108,8 +315,159 @@ func TestGenerateBytecodeForBinaryOperations(t *testing.T) {
 			continue
 		}
 		g := NewBytecodeGenerator(p.Nodes)
-		if !reflect.DeepEqual(g.Bytecode, tt.want) {
-			t.Errorf("Failed to generate bytecode. Got `%v`, expected `%v`.", g.Bytecode, tt.want)
+		if !reflect.DeepEqual(g.Lines(), tt.want) {
+			t.Errorf("Failed to generate bytecode. Got `%v`, expected `%v`.", g.Lines(), tt.want)
+		}
+	}
+}
+
+func TestGenerateConstantPool(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"+ 1 1", "CONST\t0\t1\nPUSH_CONST\t0\nPUSH_CONST\t0\nBINARY_OP\tADD"},
+		{"+ 1_000 1000.0", "CONST\t0\t1_000\nCONST\t1\t1000.0\nPUSH_CONST\t0\nPUSH_CONST\t1\nBINARY_OP\tADD"},
+		{"def f(n) = * n 2 ;; f(2)", strings.Join([]string{
+			"CONST\t0\t2",
+			"MAKE_FUNC\tf\t4\tn",
+			"LOAD_LOCAL\t0\t0\tn",
+			"PUSH_CONST\t0",
+			"BINARY_OP\tMUL",
+			"RETURN",
+			"STORE_GLOBAL\t0\tf",
+			"PUSH_CONST\t0",
+			"LOAD_GLOBAL\t0\tf",
+			"CALL_FUNC\tf\t1",
+		}, "\n")},
+	}
+
+	for _, tt := range tests {
+		l, err := NewLexer(tt.input)
+		if err != nil {
+			t.Fatalf("Failed to tokenize input `%s`: %v", tt.input, err)
+			continue
 		}
+		p, err := NewParser(l.Tokens)
+		if err != nil {
+			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", tt.input, err)
+			continue
+		}
+		g := NewBytecodeGenerator(p.Nodes)
+		if got := g.Program().String(); got != tt.want {
+			t.Errorf("Failed to generate bytecode. Got `%v`, expected `%v`.", got, tt.want)
+		}
+	}
+}
+
+func TestGeneratePositions(t *testing.T) {
+	input := "def f(n) = * n 2\nf(3)"
+	l, err := NewLexer(input)
+	if err != nil {
+		t.Fatalf("Failed to tokenize input `%s`: %v", input, err)
+	}
+	p, err := NewParser(l.Tokens)
+	if err != nil {
+		t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", input, err)
+	}
+
+	// Every instruction gets the position of the node it is generated for,
+	// even inside the body of a function.
+	want := []bytecode.Position{
+		{Line: 1, Column: 1},  // MAKE_FUNC
+		{Line: 1, Column: 14}, // LOAD_LOCAL n
+		{Line: 1, Column: 16}, // PUSH_CONST 2
+		{Line: 1, Column: 12}, // BINARY_OP MUL
+		{Line: 1, Column: 1},  // RETURN
+		{Line: 1, Column: 1},  // STORE_GLOBAL f
+		{Line: 2, Column: 3},  // PUSH_CONST 3
+		{Line: 2, Column: 1},  // LOAD_GLOBAL f
+		{Line: 2, Column: 1},  // CALL_FUNC f
+	}
+	if g := NewBytecodeGenerator(p.Nodes, WithPositions(p.Positions)); !reflect.DeepEqual(g.Program().Positions, want) {
+		t.Errorf("Expected the positions %v, got %v!", want, g.Program().Positions)
+	}
+	if g := NewBytecodeGenerator(p.Nodes); g.Program().Positions != nil {
+		t.Errorf("Expected no positions without WithPositions, got %v!", g.Program().Positions)
+	}
+}
+
+func TestGeneratePositionsInOtherNotations(t *testing.T) {
+	tests := []struct {
+		input string
+		parse func([]Token) (*Parser, error)
+		want  []bytecode.Position
+	}{
+		{
+			"1 + 2 * 3",
+			func(tokens []Token) (*Parser, error) {
+				p, err := NewInfixParser(tokens)
+				return &p.Parser, err
+			},
+			[]bytecode.Position{{Line: 1, Column: 1}, {Line: 1, Column: 5}, {Line: 1, Column: 9}, {Line: 1, Column: 7}, {Line: 1, Column: 3}},
+		},
+		{
+			"1 2 3 * +",
+			func(tokens []Token) (*Parser, error) {
+				p, err := NewPostfixParser(tokens)
+				return &p.Parser, err
+			},
+			[]bytecode.Position{{Line: 1, Column: 1}, {Line: 1, Column: 3}, {Line: 1, Column: 5}, {Line: 1, Column: 7}, {Line: 1, Column: 9}},
+		},
+	}
+
+	for _, tt := range tests {
+		l, err := NewLexer(tt.input)
+		if err != nil {
+			t.Fatalf("Failed to tokenize input `%s`: %v", tt.input, err)
+		}
+		p, err := tt.parse(l.Tokens)
+		if err != nil {
+			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", tt.input, err)
+		}
+		if g := NewBytecodeGenerator(p.Nodes, WithPositions(p.Positions)); !reflect.DeepEqual(g.Program().Positions, tt.want) {
+			t.Errorf("Expected the positions %v for input `%s`, got %v!", tt.want, tt.input, g.Program().Positions)
+		}
+	}
+}
+
+func TestAssembleGeneratedListing(t *testing.T) {
+	inputs := []string{
+		"def factorial(n, acc) = ? <= n 1 acc factorial(- n 1, * n acc)\nfactorial(20, 1)",
+		"def adder(n) = fn(x) + x n\nadd5 = adder(5)\nsum(k, 1, 10, let d = - k 1 in * d add5(d))",
+		"const g = 9.81\nto * g 2 m km",
+	}
+
+	for _, input := range inputs {
+		l, err := NewLexer(input)
+		if err != nil {
+			t.Fatalf("Failed to tokenize input `%s`: %v", input, err)
+		}
+		p, err := NewParser(l.Tokens)
+		if err != nil {
+			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", input, err)
+		}
+
+		want := NewBytecodeGenerator(p.Nodes).Program()
+		got, err := bytecode.Assemble(want.String())
+		if err != nil {
+			t.Fatalf("Failed to assemble the listing of `%s`: %v", input, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("The assembled listing of `%s` differs from the generated program! Got `%v`, want `%v`.", input, got, want)
+		}
+	}
+}
+
+func TestGenerateUnknownStackWord(t *testing.T) {
+	for _, word := range []string{"rot", "return"} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("Expected a panic for the stack word `%s`.", word)
+				}
+			}()
+			NewBytecodeGenerator([]ASTNode{&StackOpNode{Word: word}})
+		}()
 	}
 }
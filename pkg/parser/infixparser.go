@@ -0,0 +1,383 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+type InfixParser struct {
+	Parser
+}
+
+func isSignedNumber(tok Token) bool {
+	return tok.Kind == NUM && (strings.HasPrefix(tok.Value, "-") || strings.HasPrefix(tok.Value, "+"))
+}
+
+// The lexer glues a sign to the following digits, so `1 -2` arrives as two
+// numbers. Splitting the sign off lets it act as an operator again.
+func (p *InfixParser) splitSign() TokenKind {
+	op := TokenKind(ADD)
+	if p.currTok.Value[0] == '-' {
+		op = SUB
+	}
+	p.currTok = Token{
+		Pos:   Position{Row: p.currTok.Pos.Row, Col: p.currTok.Pos.Col + 1},
+		Kind:  NUM,
+		Value: p.currTok.Value[1:],
+	}
+	return op
+}
+
+func (p *InfixParser) parseCall() (*CallNode, error) {
+	callee := p.parseIdentifier()
+	if err := p.expectKind(LPAREN); err != nil {
+		return nil, err
+	}
+	var args []ExprNode
+	for p.currTok.Kind != RPAREN {
+		expr, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, expr)
+		if p.currTok.Kind != COMMA {
+			break
+		}
+		p.advance()
+	}
+	if err := p.expectKind(RPAREN); err != nil {
+		return nil, err
+	}
+	return &CallNode{Callee: callee, Args: args}, nil
+}
+
+func (p *InfixParser) parseLambda() (*LambdaNode, error) {
+	if err := p.expectKind(FN); err != nil {
+		return nil, err
+	}
+	params, err := p.parseParameters()
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.parseScoped(params, p.parseExpression)
+	if err != nil {
+		return nil, err
+	}
+	return &LambdaNode{Params: params, Body: body}, nil
+}
+
+func (p *InfixParser) parseConditional() (*ConditionalNode, error) {
+	if err := p.expectKind(IF); err != nil {
+		return nil, err
+	}
+	cond, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	} else if err := p.expectKind(THEN); err != nil {
+		return nil, err
+	}
+	then, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	} else if err := p.expectKind(ELSE); err != nil {
+		return nil, err
+	}
+	alternative, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	return &ConditionalNode{Cond: cond, Then: then, Else: alternative}, nil
+}
+
+// Operations are marked at their operator, which tells them apart from their
+// left operand.
+func (p *InfixParser) markUnary(node *UnaryOpNode, pos Position) *UnaryOpNode {
+	p.mark(node, pos)
+	return node
+}
+
+func (p *InfixParser) markBinary(node *BinaryOpNode, pos Position) *BinaryOpNode {
+	p.mark(node, pos)
+	return node
+}
+
+func (p *InfixParser) parsePrimary() (node ExprNode, err error) {
+	pos := p.currTok.Pos
+	defer func() {
+		if err == nil {
+			p.mark(node, pos)
+		}
+	}()
+
+	switch {
+	case p.currTok.Kind == IF:
+		return p.parseConditional()
+	case p.currTok.Kind == FN:
+		return p.parseLambda()
+	case p.currTok.Kind == SUM || p.currTok.Kind == PROD:
+		return p.parseSeriesWith(p.parseExpression)
+	case p.currTok.Kind == LET:
+		return p.parseLetWith(p.parseExpression, p.parseExpression)
+	case p.currTok.Kind == NUM:
+		return p.parseNumber()
+	case p.currTok.Kind == IDENT && p.nextTok.Kind == LPAREN:
+		return p.parseCall()
+	case p.currTok.Kind == IDENT:
+		return p.parseIdentifier(), nil
+	case p.currTok.Kind == LPAREN:
+		p.advance()
+		inner, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKind(RPAREN); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	}
+	return nil, fmt.Errorf(
+		"Expected an operand, got `%s` at line %d, column %d.",
+		p.currTok.Kind,
+		p.currTok.Pos.Row,
+		p.currTok.Pos.Col,
+	)
+}
+
+func (p *InfixParser) parsePostfix() (ExprNode, error) {
+	node, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.currTok.Kind == FACT {
+		pos := p.currTok.Pos
+		p.advance()
+		node = &UnaryOpNode{Operand: node, Op: FACT}
+		p.mark(node, pos)
+	}
+	return node, nil
+}
+
+func (p *InfixParser) parsePower() (ExprNode, error) {
+	left, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	} else if p.currTok.Kind != POW {
+		return left, nil
+	}
+	pos := p.currTok.Pos
+	p.advance()
+	right, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return p.markBinary(&BinaryOpNode{Left: left, Op: POW, Right: right}, pos), nil
+}
+
+func (p *InfixParser) parseUnary() (ExprNode, error) {
+	pos := p.currTok.Pos
+	if isSignedNumber(p.currTok) && p.nextTok.Kind == POW {
+		op := p.splitSign()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return p.markUnary(&UnaryOpNode{Operand: operand, Op: op}, pos), nil
+	} else if p.currTok.Kind == ADD || p.currTok.Kind == SUB || p.currTok.Kind == BNOT || p.currTok.Kind == SQRT {
+		op := p.currTok.Kind
+		p.advance()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return p.markUnary(&UnaryOpNode{Operand: operand, Op: op}, pos), nil
+	}
+	return p.parsePower()
+}
+
+func (p *InfixParser) parseMultiplicative() (ExprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.currTok.Kind == MUL || p.currTok.Kind == DIV || p.currTok.Kind == IDIV || p.currTok.Kind == MOD {
+		op, pos := p.currTok.Kind, p.currTok.Pos
+		p.advance()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = p.markBinary(&BinaryOpNode{Left: left, Op: op, Right: right}, pos)
+	}
+	return left, nil
+}
+
+func (p *InfixParser) parseAdditive() (ExprNode, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.currTok.Kind == ADD || p.currTok.Kind == SUB || isSignedNumber(p.currTok) {
+		var op TokenKind
+		pos := p.currTok.Pos
+		if p.currTok.Kind == NUM {
+			op = p.splitSign()
+		} else {
+			op = p.currTok.Kind
+			p.advance()
+		}
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = p.markBinary(&BinaryOpNode{Left: left, Op: op, Right: right}, pos)
+	}
+	return left, nil
+}
+
+func (p *InfixParser) parseShift() (ExprNode, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	for p.currTok.Kind == SHL || p.currTok.Kind == SHR {
+		op, pos := p.currTok.Kind, p.currTok.Pos
+		p.advance()
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		left = p.markBinary(&BinaryOpNode{Left: left, Op: op, Right: right}, pos)
+	}
+	return left, nil
+}
+
+// The bitwise operators bind tighter than comparisons, from `&` through
+// `xor` to `|`, so `x & 1 == 0` tests the masked value.
+func (p *InfixParser) parseBitwise() (ExprNode, error) {
+	return p.parseLogical(BOR, func() (ExprNode, error) {
+		return p.parseLogical(BXOR, func() (ExprNode, error) {
+			return p.parseLogical(BAND, p.parseShift)
+		})
+	})
+}
+
+func (p *InfixParser) parseComparison() (ExprNode, error) {
+	left, err := p.parseBitwise()
+	if err != nil {
+		return nil, err
+	} else if !isComparisonOperator(p.currTok.Kind) {
+		return left, nil
+	}
+	op, pos := p.currTok.Kind, p.currTok.Pos
+	p.advance()
+	right, err := p.parseBitwise()
+	if err != nil {
+		return nil, err
+	}
+	return p.markBinary(&BinaryOpNode{Left: left, Op: op, Right: right}, pos), nil
+}
+
+func (p *InfixParser) parseNot() (ExprNode, error) {
+	if p.currTok.Kind != NOT {
+		return p.parseComparison()
+	}
+	pos := p.currTok.Pos
+	p.advance()
+	operand, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	return p.markUnary(&UnaryOpNode{Operand: operand, Op: NOT}, pos), nil
+}
+
+func (p *InfixParser) parseLogical(op TokenKind, parseOperand func() (ExprNode, error)) (ExprNode, error) {
+	left, err := parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	for p.currTok.Kind == op {
+		pos := p.currTok.Pos
+		p.advance()
+		right, err := parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		left = p.markBinary(&BinaryOpNode{Left: left, Op: op, Right: right}, pos)
+	}
+	return left, nil
+}
+
+// A conversion binds loosest, so `3 m / 2 s to km / h` converts the whole
+// quotient.
+func (p *InfixParser) parseExpression() (ExprNode, error) {
+	return p.parseLogical(TO, func() (ExprNode, error) {
+		return p.parseLogical(OR, func() (ExprNode, error) {
+			return p.parseLogical(AND, p.parseNot)
+		})
+	})
+}
+
+func (p *InfixParser) parseFullExpression() (ExprNode, error) {
+	value, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	} else if !p.atStatementEnd() {
+		return nil, fmt.Errorf(
+			"Unexpected token `%s` found after expression at line %d, column %d.",
+			p.currTok.Value,
+			p.currTok.Pos.Row,
+			p.currTok.Pos.Col,
+		)
+	}
+	return value, nil
+}
+
+func (p *InfixParser) parseVariableDeclaration() (*VariableDeclNode, error) {
+	variable := p.parseIdentifier()
+	if err := p.expectKind(EQUAL); err != nil {
+		return nil, err
+	}
+	value, err := p.parseFullExpression()
+	if err != nil {
+		return nil, err
+	}
+	return &VariableDeclNode{Variable: variable, Value: value}, nil
+}
+
+func (p *InfixParser) parseFunctionDeclaration() (*FunctionDeclNode, error) {
+	name, params, err := p.parseFunctionSignature()
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.parseScoped(params, p.parseFullExpression)
+	if err != nil {
+		return nil, err
+	}
+	return &FunctionDeclNode{Name: name, Params: params, Body: body}, nil
+}
+
+func (p *InfixParser) parseStatement() (ASTNode, error) {
+	if p.currTok.Kind == DEF {
+		return p.parseFunctionDeclaration()
+	} else if p.currTok.Kind == CONST {
+		return p.parseConstantDeclaration(p.parseVariableDeclaration)
+	} else if p.currTok.Kind == IDENT && p.nextTok.Kind == EQUAL {
+		return p.parseVariableDeclaration()
+	}
+	return p.parseFullExpression()
+}
+
+func (p *InfixParser) Parse() error {
+	return p.parseProgram(func() ([]ASTNode, error) {
+		node, err := p.parseStatement()
+		return []ASTNode{node}, err
+	})
+}
+
+func NewInfixParser(tokens []Token, options ...ParserOption) (*InfixParser, error) {
+	p := &InfixParser{Parser: Parser{tokens: tokens}}
+	for _, option := range options {
+		option(&p.Parser)
+	}
+	return p, p.Parse()
+}
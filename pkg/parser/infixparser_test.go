@@ -0,0 +1,273 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseInfixPrecedence(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []ASTNode
+	}{
+		{"1 + 2 * 3", []ASTNode{
+			&BinaryOpNode{
+				Left: &NumberNode{Value: "1"},
+				Op:   ADD,
+				Right: &BinaryOpNode{
+					Left:  &NumberNode{Value: "2"},
+					Op:    MUL,
+					Right: &NumberNode{Value: "3"},
+				},
+			},
+		}},
+		{"(1 + 2) * 3", []ASTNode{
+			&BinaryOpNode{
+				Left: &BinaryOpNode{
+					Left:  &NumberNode{Value: "1"},
+					Op:    ADD,
+					Right: &NumberNode{Value: "2"},
+				},
+				Op:    MUL,
+				Right: &NumberNode{Value: "3"},
+			},
+		}},
+		{"8-2", []ASTNode{
+			&BinaryOpNode{
+				Left:  &NumberNode{Value: "8"},
+				Op:    SUB,
+				Right: &NumberNode{Value: "2"},
+			},
+		}},
+		{"-2 ^ 2", []ASTNode{
+			&UnaryOpNode{
+				Operand: &BinaryOpNode{
+					Left:  &NumberNode{Value: "2"},
+					Op:    POW,
+					Right: &NumberNode{Value: "2"},
+				},
+				Op: SUB,
+			},
+		}},
+	}
+
+	for _, tt := range tests {
+		l, err := NewLexer(tt.input)
+		if err != nil {
+			t.Fatalf("Failed to tokenize input `%s`: %v", tt.input, err)
+		}
+		p, err := NewInfixParser(l.Tokens)
+		if err != nil {
+			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", tt.input, err)
+		}
+		if !reflect.DeepEqual(p.Nodes, tt.want) {
+			t.Errorf("Failed to parse infix expression. Got `%v`, expected `%v`.", p.Nodes, tt.want)
+		}
+	}
+}
+
+func TestParseInfixAssociativity(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []ASTNode
+	}{
+		{"10 - 4 - 3", []ASTNode{
+			&BinaryOpNode{
+				Left: &BinaryOpNode{
+					Left:  &NumberNode{Value: "10"},
+					Op:    SUB,
+					Right: &NumberNode{Value: "4"},
+				},
+				Op:    SUB,
+				Right: &NumberNode{Value: "3"},
+			},
+		}},
+		{"2 ^ 3 ^ 2", []ASTNode{
+			&BinaryOpNode{
+				Left: &NumberNode{Value: "2"},
+				Op:   POW,
+				Right: &BinaryOpNode{
+					Left:  &NumberNode{Value: "3"},
+					Op:    POW,
+					Right: &NumberNode{Value: "2"},
+				},
+			},
+		}},
+	}
+
+	for _, tt := range tests {
+		l, err := NewLexer(tt.input)
+		if err != nil {
+			t.Fatalf("Failed to tokenize input `%s`: %v", tt.input, err)
+		}
+		p, err := NewInfixParser(l.Tokens)
+		if err != nil {
+			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", tt.input, err)
+		}
+		if !reflect.DeepEqual(p.Nodes, tt.want) {
+			t.Errorf("Failed to parse infix expression. Got `%v`, expected `%v`.", p.Nodes, tt.want)
+		}
+	}
+}
+
+func TestParseInfixCallsAndDeclarations(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []ASTNode
+	}{
+		{"max(1, 2 * x) + 3!", []ASTNode{
+			&BinaryOpNode{
+				Left: &CallNode{
+					Callee: &IdentifierNode{Value: "max"},
+					Args: []ExprNode{
+						&NumberNode{Value: "1"},
+						&BinaryOpNode{
+							Left:  &NumberNode{Value: "2"},
+							Op:    MUL,
+							Right: &IdentifierNode{Value: "x"},
+						},
+					},
+				},
+				Op:    ADD,
+				Right: &UnaryOpNode{Operand: &NumberNode{Value: "3"}, Op: FACT},
+			},
+		}},
+		{"if x then 1 else 2 * x", []ASTNode{
+			&ConditionalNode{
+				Cond: &IdentifierNode{Value: "x"},
+				Then: &NumberNode{Value: "1"},
+				Else: &BinaryOpNode{
+					Left:  &NumberNode{Value: "2"},
+					Op:    MUL,
+					Right: &IdentifierNode{Value: "x"},
+				},
+			},
+		}},
+		{"y = rand()", []ASTNode{
+			&VariableDeclNode{
+				Variable: &IdentifierNode{Value: "y"},
+				Value:    &CallNode{Callee: &IdentifierNode{Value: "rand"}},
+			},
+		}},
+	}
+
+	for _, tt := range tests {
+		l, err := NewLexer(tt.input)
+		if err != nil {
+			t.Fatalf("Failed to tokenize input `%s`: %v", tt.input, err)
+		}
+		p, err := NewInfixParser(l.Tokens)
+		if err != nil {
+			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", tt.input, err)
+		}
+		if !reflect.DeepEqual(p.Nodes, tt.want) {
+			t.Errorf("Failed to parse infix expression. Got `%v`, expected `%v`.", p.Nodes, tt.want)
+		}
+	}
+}
+
+func TestParseInfixErrors(t *testing.T) {
+	inputs := []string{"1 +", "(1 + 2", "1 2", "* 3"}
+
+	for _, input := range inputs {
+		l, err := NewLexer(input)
+		if err != nil {
+			t.Fatalf("Failed to tokenize input `%s`: %v", input, err)
+		}
+		if _, err := NewInfixParser(l.Tokens); err == nil {
+			t.Errorf("Expected a syntax error for input `%s`.", input)
+		}
+	}
+}
+
+func TestParseInfixLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []ASTNode
+	}{
+		{"not x < 1 or y and z", []ASTNode{
+			&BinaryOpNode{
+				Left: &UnaryOpNode{
+					Operand: &BinaryOpNode{
+						Left:  &IdentifierNode{Value: "x"},
+						Op:    LT,
+						Right: &NumberNode{Value: "1"},
+					},
+					Op: NOT,
+				},
+				Op: OR,
+				Right: &BinaryOpNode{
+					Left:  &IdentifierNode{Value: "y"},
+					Op:    AND,
+					Right: &IdentifierNode{Value: "z"},
+				},
+			},
+		}},
+	}
+
+	for _, tt := range tests {
+		l, err := NewLexer(tt.input)
+		if err != nil {
+			t.Fatalf("Failed to tokenize input `%s`: %v", tt.input, err)
+		}
+		p, err := NewInfixParser(l.Tokens)
+		if err != nil {
+			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", tt.input, err)
+		}
+		if !reflect.DeepEqual(p.Nodes, tt.want) {
+			t.Errorf("Failed to parse infix expression. Got `%v`, expected `%v`.", p.Nodes, tt.want)
+		}
+	}
+}
+
+func TestParseInfixBitwiseOperators(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []ASTNode
+	}{
+		{"x & 1 << 2 == 0", []ASTNode{
+			&BinaryOpNode{
+				Left: &BinaryOpNode{
+					Left: &IdentifierNode{Value: "x"},
+					Op:   BAND,
+					Right: &BinaryOpNode{
+						Left:  &NumberNode{Value: "1"},
+						Op:    SHL,
+						Right: &NumberNode{Value: "2"},
+					},
+				},
+				Op:    EQ,
+				Right: &NumberNode{Value: "0"},
+			},
+		}},
+		{"a | b xor ~c // 2", []ASTNode{
+			&BinaryOpNode{
+				Left: &IdentifierNode{Value: "a"},
+				Op:   BOR,
+				Right: &BinaryOpNode{
+					Left: &IdentifierNode{Value: "b"},
+					Op:   BXOR,
+					Right: &BinaryOpNode{
+						Left:  &UnaryOpNode{Operand: &IdentifierNode{Value: "c"}, Op: BNOT},
+						Op:    IDIV,
+						Right: &NumberNode{Value: "2"},
+					},
+				},
+			},
+		}},
+	}
+
+	for _, tt := range tests {
+		l, err := NewLexer(tt.input)
+		if err != nil {
+			t.Fatalf("Failed to tokenize input `%s`: %v", tt.input, err)
+		}
+		p, err := NewInfixParser(l.Tokens)
+		if err != nil {
+			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", tt.input, err)
+		}
+		if !reflect.DeepEqual(p.Nodes, tt.want) {
+			t.Errorf("Failed to parse infix expression. Got `%v`, expected `%v`.", p.Nodes, tt.want)
+		}
+	}
+}
@@ -3,14 +3,29 @@ package parser
 import (
 	"fmt"
 	"strings"
+	"unicode"
 )
 
 type Lexer struct {
-	Input  []string
-	pos    Position
-	currCh byte
-	nextCh byte
-	Tokens []Token
+	Input      []string
+	lines      [][]rune
+	pos        Position
+	currCh     rune
+	nextCh     rune
+	depth      int
+	keepTrivia bool
+	trivia     []Trivia
+	Tokens     []Token
+}
+
+type LexerOption func(*Lexer)
+
+// WithTrivia attaches the whitespace and comments before every token to it,
+// so that the source can be reproduced exactly from the tokens.
+func WithTrivia() LexerOption {
+	return func(l *Lexer) {
+		l.keepTrivia = true
+	}
 }
 
 func (l Lexer) String() string {
@@ -21,41 +36,81 @@ func (l Lexer) String() string {
 	return strings.Join(tokenStrings, "\n")
 }
 
+// Source joins the tokens back into the input, which is only lossless for a
+// lexer created with WithTrivia.
+func (l Lexer) Source() string {
+	var source strings.Builder
+	for _, token := range l.Tokens {
+		for _, trivia := range token.Leading {
+			source.WriteString(trivia.Text)
+		}
+		source.WriteString(token.Value)
+	}
+	return source.String()
+}
+
+// Lines are scanned as runes, so columns count characters rather than bytes.
+func (l *Lexer) charAt(row, col int) rune {
+	if col < len(l.lines[row]) {
+		return l.lines[row][col]
+	} else if row < len(l.lines)-1 {
+		return '\n'
+	}
+	return 0
+}
+
 func (l *Lexer) advance() {
-	if l.pos.Row >= len(l.Input) {
+	if l.pos.Row >= len(l.lines) {
 		l.currCh = 0
 		l.nextCh = 0
 		return
-	} else if l.pos.Col >= len(l.Input[l.pos.Row]) {
+	} else if l.pos.Col > len(l.lines[l.pos.Row]) {
 		l.pos.Row++
 		l.pos.Col = 0
 		l.advance()
 		return
 	}
 
-	l.currCh = l.Input[l.pos.Row][l.pos.Col]
+	l.currCh = l.charAt(l.pos.Row, l.pos.Col)
 	l.pos.Col++
-	if l.pos.Col >= len(l.Input[l.pos.Row]) {
-		l.nextCh = 0
-	} else {
-		l.nextCh = l.Input[l.pos.Row][l.pos.Col]
+	l.nextCh = l.charAt(l.pos.Row, l.pos.Col)
+}
+
+func (l *Lexer) emit(token Token) {
+	if l.keepTrivia {
+		token.Leading = l.trivia
 	}
+	l.trivia = nil
+	l.Tokens = append(l.Tokens, token)
 }
 
-func isWhitespace(ch byte) bool {
-	return ch == ' ' || ch == '\t'
+func (l *Lexer) addTrivia(pos Position, kind TriviaKind, text string) {
+	if l.keepTrivia {
+		l.trivia = append(l.trivia, Trivia{Pos: Position{Row: pos.Row + 1, Col: pos.Col}, Kind: kind, Text: text})
+	}
+}
+
+// Carriage returns are whitespace, so that files with Windows line endings
+// read like any other.
+func isWhitespace(ch rune) bool {
+	return ch == ' ' || ch == '\t' || ch == '\r'
 }
 
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func isOperator(ch byte) bool {
-	return ch == '+' || ch == '-' || ch == '*' || ch == '/' ||
-		ch == '%' || ch == '^' || ch == '!'
+func isOperator(ch rune) bool {
+	_, ok := mathSymbols[ch]
+	return ok || ch == '+' || ch == '-' || ch == '*' || ch == '/' ||
+		ch == '%' || ch == '^' || ch == '!' || ch == '?' || ch == '<' || ch == '>' ||
+		ch == '&' || ch == '|' || ch == '~'
 }
 
-func classifyOperator(ch byte) (TokenKind, error) {
+func classifyOperator(ch rune) (TokenKind, error) {
+	if kind, ok := mathSymbols[ch]; ok {
+		return kind, nil
+	}
 	switch ch {
 	case '!':
 		return FACT, nil
@@ -71,15 +126,47 @@ func classifyOperator(ch byte) (TokenKind, error) {
 		return MOD, nil
 	case '^':
 		return POW, nil
+	case '?':
+		return COND, nil
+	case '<':
+		return LT, nil
+	case '>':
+		return GT, nil
+	case '&':
+		return BAND, nil
+	case '|':
+		return BOR, nil
+	case '~':
+		return BNOT, nil
 	}
 	return 0, fmt.Errorf("Invalid operator: `%c`", ch)
 }
 
-func isSymbol(ch byte) bool {
+func classifyCompoundOperator(ch, next rune) (TokenKind, bool) {
+	switch string([]rune{ch, next}) {
+	case "<=":
+		return LE, true
+	case ">=":
+		return GE, true
+	case "==":
+		return EQ, true
+	case "!=":
+		return NE, true
+	case "//":
+		return IDIV, true
+	case "<<":
+		return SHL, true
+	case ">>":
+		return SHR, true
+	}
+	return 0, false
+}
+
+func isSymbol(ch rune) bool {
 	return ch == '(' || ch == ')' || ch == ',' || ch == '=' || ch == ';'
 }
 
-func classifySymbol(ch byte) (TokenKind, error) {
+func classifySymbol(ch rune) (TokenKind, error) {
 	switch ch {
 	case '(':
 		return LPAREN, nil
@@ -93,6 +180,47 @@ func classifySymbol(ch byte) (TokenKind, error) {
 	return 0, fmt.Errorf("Invalid symbol: `%c`", ch)
 }
 
+func isDigitOf(ch rune, base int) bool {
+	switch base {
+	case 2:
+		return ch == '0' || ch == '1'
+	case 8:
+		return '0' <= ch && ch <= '7'
+	case 16:
+		return isDigit(ch) || ('a' <= ch && ch <= 'f') || ('A' <= ch && ch <= 'F')
+	}
+	return isDigit(ch)
+}
+
+var basePrefixes = map[rune]int{'x': 16, 'X': 16, 'b': 2, 'B': 2, 'o': 8, 'O': 8}
+
+// Underscores may only separate two digits, as in `1_000_000`.
+func (l *Lexer) lexDigits(base int) string {
+	var digits string
+	for {
+		if isDigitOf(l.currCh, base) {
+			digits += string(l.currCh)
+		} else if l.currCh == '_' && digits != "" && isDigitOf(l.nextCh, base) {
+			digits += "_"
+		} else {
+			return digits
+		}
+		l.advance()
+	}
+}
+
+func (l *Lexer) malformedNumber(num string, pos Position) error {
+	for ; isLetter(l.currCh) || isDigit(l.currCh) || l.currCh == '_' || l.currCh == '.'; l.advance() {
+		num += string(l.currCh)
+	}
+	return fmt.Errorf(
+		"Malformed number `%s`! Line %d, column %d.",
+		num,
+		pos.Row+1,
+		pos.Col,
+	)
+}
+
 func (l *Lexer) lexNumber() error {
 	pos := l.pos
 	var num string
@@ -101,20 +229,45 @@ func (l *Lexer) lexNumber() error {
 		num += string(l.currCh)
 		l.advance()
 	}
-	for ; isDigit(l.currCh) || (l.currCh == '.' && !strings.Contains(num, ".")); l.advance() {
+	if base, ok := basePrefixes[l.nextCh]; ok && l.currCh == '0' {
+		num += string([]rune{l.currCh, l.nextCh})
+		l.advance()
+		l.advance()
+		digits := l.lexDigits(base)
+		if digits == "" {
+			return l.malformedNumber(num, pos)
+		}
+		num += digits
+	} else {
+		num += l.lexDigits(10)
+		if l.currCh == '.' {
+			num += "."
+			l.advance()
+			num += l.lexDigits(10)
+		}
+		if l.currCh == 'e' || l.currCh == 'E' {
+			num += string(l.currCh)
+			l.advance()
+			if l.currCh == '-' || l.currCh == '+' {
+				num += string(l.currCh)
+				l.advance()
+			}
+			exponent := l.lexDigits(10)
+			if exponent == "" {
+				return l.malformedNumber(num, pos)
+			}
+			num += exponent
+		}
+	}
+	if l.currCh == 'i' && !isLetter(l.nextCh) && !isDigit(l.nextCh) {
 		num += string(l.currCh)
+		l.advance()
 	}
-	if l.currCh != 0 && !isWhitespace(l.currCh) && !isOperator(l.currCh) && !isSymbol(l.currCh) {
-		return fmt.Errorf(
-			"Invalid sequence `%s%c`! Line %d, column %d.",
-			num,
-			l.currCh,
-			pos.Row+1,
-			pos.Col,
-		)
+	if l.currCh != 0 && l.currCh != '\n' && l.currCh != '#' && !isWhitespace(l.currCh) && !isOperator(l.currCh) && !isSymbol(l.currCh) {
+		return l.malformedNumber(num, pos)
 	}
 
-	l.Tokens = append(l.Tokens, Token{
+	l.emit(Token{
 		Pos:   Position{Row: pos.Row + 1, Col: pos.Col},
 		Kind:  NUM,
 		Value: num,
@@ -122,45 +275,107 @@ func (l *Lexer) lexNumber() error {
 	return nil
 }
 
-func isLetter(ch byte) bool {
-	return ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z')
+func isLetter(ch rune) bool {
+	return unicode.IsLetter(ch)
 }
 
 func (l *Lexer) lexIdentifier() {
 	pos := l.pos
 	var id string
 
-	for ; isLetter(l.currCh) || isDigit(l.currCh); l.advance() {
+	// Combining marks keep decomposed accents like `e\u0301` in one name.
+	for ; isLetter(l.currCh) || isDigit(l.currCh) || unicode.Is(unicode.Mn, l.currCh); l.advance() {
 		id += string(l.currCh)
-		if l.nextCh == 0 {
-			l.advance()
-			break
-		}
 	}
-	l.Tokens = append(l.Tokens, Token{
+	kind, ok := keywords[id]
+	if !ok {
+		kind = IDENT
+	}
+	l.emit(Token{
 		Pos:   Position{Row: pos.Row + 1, Col: pos.Col},
-		Kind:  IDENT,
+		Kind:  kind,
 		Value: id,
 	})
 }
 
+// Line breaks only separate statements outside of parentheses; inside them
+// they are whitespace like any other.
+func (l *Lexer) lexWhitespace() {
+	pos := l.pos
+	var text string
+
+	for ; isWhitespace(l.currCh) || (l.currCh == '\n' && l.depth > 0); l.advance() {
+		text += string(l.currCh)
+	}
+	l.addTrivia(pos, WHITESPACE, text)
+}
+
+// A `#` comment runs to the end of its line, while a `/* */` one may span
+// several lines.
+func (l *Lexer) lexComment() error {
+	pos := l.pos
+	var text string
+
+	if l.currCh == '#' {
+		for ; l.currCh != 0 && l.currCh != '\n'; l.advance() {
+			text += string(l.currCh)
+		}
+		l.addTrivia(pos, COMMENT, text)
+		return nil
+	}
+	text = "/*"
+	l.advance()
+	for l.advance(); l.currCh != '*' || l.nextCh != '/'; l.advance() {
+		if l.currCh == 0 {
+			return fmt.Errorf(
+				"Unterminated comment! Line %d, column %d.",
+				pos.Row+1,
+				pos.Col,
+			)
+		}
+		text += string(l.currCh)
+	}
+	l.advance()
+	l.advance()
+	l.addTrivia(pos, COMMENT, text+"*/")
+	return nil
+}
+
 func (l *Lexer) Lex() error {
 	for l.advance(); l.currCh != 0; {
-		if isWhitespace(l.currCh) {
+		if isWhitespace(l.currCh) || (l.currCh == '\n' && l.depth > 0) {
+			l.lexWhitespace()
+		} else if l.currCh == '#' || (l.currCh == '/' && l.nextCh == '*') {
+			if err := l.lexComment(); err != nil {
+				return err
+			}
+		} else if l.currCh == '\n' {
+			l.emit(Token{
+				Pos:   Position{Row: l.pos.Row + 1, Col: l.pos.Col},
+				Kind:  SEMI,
+				Value: "\n",
+			})
 			l.advance()
-			continue
 		} else if isDigit(l.currCh) || (l.currCh == '-' || l.currCh == '+') && isDigit(l.nextCh) {
 			if err := l.lexNumber(); err != nil {
 				return err
 			}
 		} else if isLetter(l.currCh) {
 			l.lexIdentifier()
+		} else if kind, ok := classifyCompoundOperator(l.currCh, l.nextCh); ok {
+			l.emit(Token{
+				Pos:   Position{Row: l.pos.Row + 1, Col: l.pos.Col},
+				Kind:  kind,
+				Value: string([]rune{l.currCh, l.nextCh}),
+			})
+			l.advance()
+			l.advance()
 		} else if isOperator(l.currCh) {
 			kind, err := classifyOperator(l.currCh)
 			if err != nil {
 				return err
 			}
-			l.Tokens = append(l.Tokens, Token{
+			l.emit(Token{
 				Pos:   Position{Row: l.pos.Row + 1, Col: l.pos.Col},
 				Kind:  kind,
 				Value: string(l.currCh),
@@ -168,8 +383,12 @@ func (l *Lexer) Lex() error {
 			l.advance()
 		} else if isSymbol(l.currCh) {
 			if l.currCh == ';' && l.nextCh == ';' {
-				l.pos.Row++
-				l.pos.Col = 0
+				l.emit(Token{
+					Pos:   Position{Row: l.pos.Row + 1, Col: l.pos.Col},
+					Kind:  SEMI,
+					Value: ";;",
+				})
+				l.advance()
 				l.advance()
 				continue
 			} else if l.currCh == ';' {
@@ -183,8 +402,12 @@ func (l *Lexer) Lex() error {
 			kind, err := classifySymbol(l.currCh)
 			if err != nil {
 				return err
+			} else if kind == LPAREN {
+				l.depth++
+			} else if kind == RPAREN && l.depth > 0 {
+				l.depth--
 			}
-			l.Tokens = append(l.Tokens, Token{
+			l.emit(Token{
 				Pos:   Position{Row: l.pos.Row + 1, Col: l.pos.Col},
 				Kind:  kind,
 				Value: string(l.currCh),
@@ -199,14 +422,20 @@ func (l *Lexer) Lex() error {
 			)
 		}
 	}
-	l.Tokens = append(l.Tokens, Token{
-		Pos:  Position{Row: l.pos.Row + 1, Col: 1},
+	l.emit(Token{
+		Pos:  Position{Row: len(l.Input) + 1, Col: 1},
 		Kind: EOF,
 	})
 	return nil
 }
 
-func NewLexer(input string) (*Lexer, error) {
+func NewLexer(input string, options ...LexerOption) (*Lexer, error) {
 	l := &Lexer{Input: strings.Split(input, "\n")}
+	for _, option := range options {
+		option(l)
+	}
+	for _, line := range l.Input {
+		l.lines = append(l.lines, []rune(line))
+	}
 	return l, l.Lex()
 }
@@ -24,6 +24,90 @@ func TestNumbers(t *testing.T) {
 	}
 }
 
+func TestImaginaryNumbers(t *testing.T) {
+	input := "3i -2.5i i"
+	want := []Token{
+		{Pos: Position{Row: 1, Col: 1}, Kind: NUM, Value: "3i"},
+		{Pos: Position{Row: 1, Col: 4}, Kind: NUM, Value: "-2.5i"},
+		{Pos: Position{Row: 1, Col: 10}, Kind: IDENT, Value: "i"},
+		{Pos: Position{Row: 2, Col: 1}, Kind: EOF},
+	}
+
+	l, err := NewLexer(input)
+	if err != nil {
+		t.Fatalf("An error while lexing! %v", err)
+	}
+	if !reflect.DeepEqual(l.Tokens, want) {
+		t.Errorf("It did not meet expectations!")
+	}
+}
+
+func TestNumberNotations(t *testing.T) {
+	input := "1e-9 0xFF 0b1010 0o17 1_000_000 2.5E3"
+	want := []Token{
+		{Pos: Position{Row: 1, Col: 1}, Kind: NUM, Value: "1e-9"},
+		{Pos: Position{Row: 1, Col: 6}, Kind: NUM, Value: "0xFF"},
+		{Pos: Position{Row: 1, Col: 11}, Kind: NUM, Value: "0b1010"},
+		{Pos: Position{Row: 1, Col: 18}, Kind: NUM, Value: "0o17"},
+		{Pos: Position{Row: 1, Col: 23}, Kind: NUM, Value: "1_000_000"},
+		{Pos: Position{Row: 1, Col: 33}, Kind: NUM, Value: "2.5E3"},
+		{Pos: Position{Row: 2, Col: 1}, Kind: EOF},
+	}
+
+	l, err := NewLexer(input)
+	if err != nil {
+		t.Fatalf("An error while lexing! %v", err)
+	}
+	if !reflect.DeepEqual(l.Tokens, want) {
+		t.Errorf("It did not meet expectations!")
+	}
+}
+
+func TestMalformedNumbers(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"0xZZ", "Malformed number `0xZZ`! Line 1, column 1."},
+		{"+ 1 1e", "Malformed number `1e`! Line 1, column 5."},
+		{"1__0", "Malformed number `1__0`! Line 1, column 1."},
+		{"1_", "Malformed number `1_`! Line 1, column 1."},
+		{"0b102", "Malformed number `0b102`! Line 1, column 1."},
+	}
+
+	for _, test := range tests {
+		_, err := NewLexer(test.input)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("Expected `%s` for `%s`, got `%v`!", test.want, test.input, err)
+		}
+	}
+}
+
+// Unit names are ordinary identifiers to the lexer; only the parser knows
+// whether they are variables.
+func TestQuantityLiterals(t *testing.T) {
+	input := "3 m s\n2.5 km to m"
+	want := []Token{
+		{Pos: Position{Row: 1, Col: 1}, Kind: NUM, Value: "3"},
+		{Pos: Position{Row: 1, Col: 3}, Kind: IDENT, Value: "m"},
+		{Pos: Position{Row: 1, Col: 5}, Kind: IDENT, Value: "s"},
+		{Pos: Position{Row: 1, Col: 6}, Kind: SEMI, Value: "\n"},
+		{Pos: Position{Row: 2, Col: 1}, Kind: NUM, Value: "2.5"},
+		{Pos: Position{Row: 2, Col: 5}, Kind: IDENT, Value: "km"},
+		{Pos: Position{Row: 2, Col: 8}, Kind: TO, Value: "to"},
+		{Pos: Position{Row: 2, Col: 11}, Kind: IDENT, Value: "m"},
+		{Pos: Position{Row: 3, Col: 1}, Kind: EOF},
+	}
+
+	l, err := NewLexer(input)
+	if err != nil {
+		t.Fatalf("An error while lexing! %v", err)
+	}
+	if !reflect.DeepEqual(l.Tokens, want) {
+		t.Errorf("It did not meet expectations! Got `%v`.", l.Tokens)
+	}
+}
+
 func TestIdentifiers(t *testing.T) {
 	input := "x x2 xy xy2 x0y0z0"
 	want := []Token{
@@ -44,6 +128,25 @@ func TestIdentifiers(t *testing.T) {
 	}
 }
 
+func TestUnicodeIdentifiers(t *testing.T) {
+	input := "π café Ωmega x1"
+	want := []Token{
+		{Pos: Position{Row: 1, Col: 1}, Kind: IDENT, Value: "π"},
+		{Pos: Position{Row: 1, Col: 3}, Kind: IDENT, Value: "café"},
+		{Pos: Position{Row: 1, Col: 8}, Kind: IDENT, Value: "Ωmega"},
+		{Pos: Position{Row: 1, Col: 14}, Kind: IDENT, Value: "x1"},
+		{Pos: Position{Row: 2, Col: 1}, Kind: EOF},
+	}
+
+	l, err := NewLexer(input)
+	if err != nil {
+		t.Fatalf("An error while lexing! %v", err)
+	}
+	if !reflect.DeepEqual(l.Tokens, want) {
+		t.Errorf("It did not meet expectations!")
+	}
+}
+
 func TestOperators(t *testing.T) {
 	input := "! + - * / % ^"
 	want := []Token{
@@ -66,13 +169,87 @@ func TestOperators(t *testing.T) {
 	}
 }
 
+func TestComparisonOperators(t *testing.T) {
+	input := "< <= > >= == != not and or"
+	want := []Token{
+		{Pos: Position{Row: 1, Col: 1}, Kind: LT, Value: "<"},
+		{Pos: Position{Row: 1, Col: 3}, Kind: LE, Value: "<="},
+		{Pos: Position{Row: 1, Col: 6}, Kind: GT, Value: ">"},
+		{Pos: Position{Row: 1, Col: 8}, Kind: GE, Value: ">="},
+		{Pos: Position{Row: 1, Col: 11}, Kind: EQ, Value: "=="},
+		{Pos: Position{Row: 1, Col: 14}, Kind: NE, Value: "!="},
+		{Pos: Position{Row: 1, Col: 17}, Kind: NOT, Value: "not"},
+		{Pos: Position{Row: 1, Col: 21}, Kind: AND, Value: "and"},
+		{Pos: Position{Row: 1, Col: 25}, Kind: OR, Value: "or"},
+		{Pos: Position{Row: 2, Col: 1}, Kind: EOF},
+	}
+
+	l, err := NewLexer(input)
+	if err != nil {
+		t.Fatalf("An error while lexing! %v", err)
+	}
+	if !reflect.DeepEqual(l.Tokens, want) {
+		t.Errorf("It did not meet expectations!")
+	}
+}
+
+func TestIntegerOperators(t *testing.T) {
+	input := "// & | xor ~ << >>"
+	want := []Token{
+		{Pos: Position{Row: 1, Col: 1}, Kind: IDIV, Value: "//"},
+		{Pos: Position{Row: 1, Col: 4}, Kind: BAND, Value: "&"},
+		{Pos: Position{Row: 1, Col: 6}, Kind: BOR, Value: "|"},
+		{Pos: Position{Row: 1, Col: 8}, Kind: BXOR, Value: "xor"},
+		{Pos: Position{Row: 1, Col: 12}, Kind: BNOT, Value: "~"},
+		{Pos: Position{Row: 1, Col: 14}, Kind: SHL, Value: "<<"},
+		{Pos: Position{Row: 1, Col: 17}, Kind: SHR, Value: ">>"},
+		{Pos: Position{Row: 2, Col: 1}, Kind: EOF},
+	}
+
+	l, err := NewLexer(input)
+	if err != nil {
+		t.Fatalf("An error while lexing! %v", err)
+	}
+	if !reflect.DeepEqual(l.Tokens, want) {
+		t.Errorf("It did not meet expectations!")
+	}
+}
+
+func TestMathSymbols(t *testing.T) {
+	input := "× · ÷ − ≤ ≥ ≠ ¬ ∧ ∨ √"
+	want := []Token{
+		{Pos: Position{Row: 1, Col: 1}, Kind: MUL, Value: "×"},
+		{Pos: Position{Row: 1, Col: 3}, Kind: MUL, Value: "·"},
+		{Pos: Position{Row: 1, Col: 5}, Kind: DIV, Value: "÷"},
+		{Pos: Position{Row: 1, Col: 7}, Kind: SUB, Value: "−"},
+		{Pos: Position{Row: 1, Col: 9}, Kind: LE, Value: "≤"},
+		{Pos: Position{Row: 1, Col: 11}, Kind: GE, Value: "≥"},
+		{Pos: Position{Row: 1, Col: 13}, Kind: NE, Value: "≠"},
+		{Pos: Position{Row: 1, Col: 15}, Kind: NOT, Value: "¬"},
+		{Pos: Position{Row: 1, Col: 17}, Kind: AND, Value: "∧"},
+		{Pos: Position{Row: 1, Col: 19}, Kind: OR, Value: "∨"},
+		{Pos: Position{Row: 1, Col: 21}, Kind: SQRT, Value: "√"},
+		{Pos: Position{Row: 2, Col: 1}, Kind: EOF},
+	}
+
+	l, err := NewLexer(input)
+	if err != nil {
+		t.Fatalf("An error while lexing! %v", err)
+	}
+	if !reflect.DeepEqual(l.Tokens, want) {
+		t.Errorf("It did not meet expectations!")
+	}
+}
+
 func TestSymbols(t *testing.T) {
-	input := "( ) , = ;; A worthless comment!"
+	input := "( ) , = ;; x"
 	want := []Token{
 		{Pos: Position{Row: 1, Col: 1}, Kind: LPAREN, Value: "("},
 		{Pos: Position{Row: 1, Col: 3}, Kind: RPAREN, Value: ")"},
 		{Pos: Position{Row: 1, Col: 5}, Kind: COMMA, Value: ","},
 		{Pos: Position{Row: 1, Col: 7}, Kind: EQUAL, Value: "="},
+		{Pos: Position{Row: 1, Col: 9}, Kind: SEMI, Value: ";;"},
+		{Pos: Position{Row: 1, Col: 12}, Kind: IDENT, Value: "x"},
 		{Pos: Position{Row: 2, Col: 1}, Kind: EOF},
 	}
 
@@ -85,6 +262,56 @@ func TestSymbols(t *testing.T) {
 	}
 }
 
+func TestStatementSeparators(t *testing.T) {
+	input := "x = 1\nmax(x,\n2) ;; y"
+	want := []Token{
+		{Pos: Position{Row: 1, Col: 1}, Kind: IDENT, Value: "x"},
+		{Pos: Position{Row: 1, Col: 3}, Kind: EQUAL, Value: "="},
+		{Pos: Position{Row: 1, Col: 5}, Kind: NUM, Value: "1"},
+		{Pos: Position{Row: 1, Col: 6}, Kind: SEMI, Value: "\n"},
+		{Pos: Position{Row: 2, Col: 1}, Kind: IDENT, Value: "max"},
+		{Pos: Position{Row: 2, Col: 4}, Kind: LPAREN, Value: "("},
+		{Pos: Position{Row: 2, Col: 5}, Kind: IDENT, Value: "x"},
+		{Pos: Position{Row: 2, Col: 6}, Kind: COMMA, Value: ","},
+		{Pos: Position{Row: 3, Col: 1}, Kind: NUM, Value: "2"},
+		{Pos: Position{Row: 3, Col: 2}, Kind: RPAREN, Value: ")"},
+		{Pos: Position{Row: 3, Col: 4}, Kind: SEMI, Value: ";;"},
+		{Pos: Position{Row: 3, Col: 7}, Kind: IDENT, Value: "y"},
+		{Pos: Position{Row: 4, Col: 1}, Kind: EOF},
+	}
+
+	l, err := NewLexer(input)
+	if err != nil {
+		t.Fatalf("An error while lexing! %v", err)
+	}
+	if !reflect.DeepEqual(l.Tokens, want) {
+		t.Errorf("It did not meet expectations!")
+	}
+}
+
+func TestWindowsLineEndings(t *testing.T) {
+	input := "x = 1\r\n+ x 2\r\n"
+	want := []Token{
+		{Pos: Position{Row: 1, Col: 1}, Kind: IDENT, Value: "x"},
+		{Pos: Position{Row: 1, Col: 3}, Kind: EQUAL, Value: "="},
+		{Pos: Position{Row: 1, Col: 5}, Kind: NUM, Value: "1"},
+		{Pos: Position{Row: 1, Col: 7}, Kind: SEMI, Value: "\n"},
+		{Pos: Position{Row: 2, Col: 1}, Kind: ADD, Value: "+"},
+		{Pos: Position{Row: 2, Col: 3}, Kind: IDENT, Value: "x"},
+		{Pos: Position{Row: 2, Col: 5}, Kind: NUM, Value: "2"},
+		{Pos: Position{Row: 2, Col: 7}, Kind: SEMI, Value: "\n"},
+		{Pos: Position{Row: 4, Col: 1}, Kind: EOF},
+	}
+
+	l, err := NewLexer(input)
+	if err != nil {
+		t.Fatalf("An error while lexing! %v", err)
+	}
+	if !reflect.DeepEqual(l.Tokens, want) {
+		t.Errorf("It did not meet expectations! Got %v, want %v.", l.Tokens, want)
+	}
+}
+
 func TestIllegalCharacters(t *testing.T) {
 	input := "π ≈ ᭠˙Ꞌꜭ"
 
@@ -93,3 +320,123 @@ func TestIllegalCharacters(t *testing.T) {
 		t.Errorf("An error while lexing! %v", err)
 	}
 }
+
+func TestIllegalCharacterColumns(t *testing.T) {
+	input := "× π 2\n√ π ≈ 3"
+	want := "Invalid character `≈`! Line 2, column 5."
+
+	_, err := NewLexer(input)
+	if err == nil || err.Error() != want {
+		t.Errorf("Expected `%s`, got `%v`!", want, err)
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := "x # the first\n/* a\nblock */ + 1/* inline */2"
+	want := []Token{
+		{Pos: Position{Row: 1, Col: 1}, Kind: IDENT, Value: "x"},
+		{Pos: Position{Row: 1, Col: 14}, Kind: SEMI, Value: "\n"},
+		{Pos: Position{Row: 3, Col: 10}, Kind: ADD, Value: "+"},
+		{Pos: Position{Row: 3, Col: 12}, Kind: NUM, Value: "1"},
+		{Pos: Position{Row: 3, Col: 25}, Kind: NUM, Value: "2"},
+		{Pos: Position{Row: 4, Col: 1}, Kind: EOF},
+	}
+
+	l, err := NewLexer(input)
+	if err != nil {
+		t.Fatalf("An error while lexing! %v", err)
+	}
+	if !reflect.DeepEqual(l.Tokens, want) {
+		t.Errorf("It did not meet expectations!")
+	}
+}
+
+func TestUnterminatedComment(t *testing.T) {
+	input := "+ 1 2\n/* never\nclosed"
+	want := "Unterminated comment! Line 2, column 1."
+
+	_, err := NewLexer(input)
+	if err == nil || err.Error() != want {
+		t.Errorf("Expected `%s`, got `%v`!", want, err)
+	}
+}
+
+func TestTrivia(t *testing.T) {
+	input := "x = ( 1 +\n\t2 ) # done\n"
+	want := []Token{
+		{Pos: Position{Row: 1, Col: 1}, Kind: IDENT, Value: "x"},
+		{
+			Pos:     Position{Row: 1, Col: 3},
+			Kind:    EQUAL,
+			Value:   "=",
+			Leading: []Trivia{{Pos: Position{Row: 1, Col: 2}, Kind: WHITESPACE, Text: " "}},
+		},
+		{
+			Pos:     Position{Row: 1, Col: 5},
+			Kind:    LPAREN,
+			Value:   "(",
+			Leading: []Trivia{{Pos: Position{Row: 1, Col: 4}, Kind: WHITESPACE, Text: " "}},
+		},
+		{
+			Pos:     Position{Row: 1, Col: 7},
+			Kind:    NUM,
+			Value:   "1",
+			Leading: []Trivia{{Pos: Position{Row: 1, Col: 6}, Kind: WHITESPACE, Text: " "}},
+		},
+		{
+			Pos:     Position{Row: 1, Col: 9},
+			Kind:    ADD,
+			Value:   "+",
+			Leading: []Trivia{{Pos: Position{Row: 1, Col: 8}, Kind: WHITESPACE, Text: " "}},
+		},
+		{
+			Pos:     Position{Row: 2, Col: 2},
+			Kind:    NUM,
+			Value:   "2",
+			Leading: []Trivia{{Pos: Position{Row: 1, Col: 10}, Kind: WHITESPACE, Text: "\n\t"}},
+		},
+		{
+			Pos:     Position{Row: 2, Col: 4},
+			Kind:    RPAREN,
+			Value:   ")",
+			Leading: []Trivia{{Pos: Position{Row: 2, Col: 3}, Kind: WHITESPACE, Text: " "}},
+		},
+		{
+			Pos:   Position{Row: 2, Col: 12},
+			Kind:  SEMI,
+			Value: "\n",
+			Leading: []Trivia{
+				{Pos: Position{Row: 2, Col: 5}, Kind: WHITESPACE, Text: " "},
+				{Pos: Position{Row: 2, Col: 6}, Kind: COMMENT, Text: "# done"},
+			},
+		},
+		{Pos: Position{Row: 4, Col: 1}, Kind: EOF},
+	}
+
+	l, err := NewLexer(input, WithTrivia())
+	if err != nil {
+		t.Fatalf("An error while lexing! %v", err)
+	}
+	if !reflect.DeepEqual(l.Tokens, want) {
+		t.Errorf("It did not meet expectations!")
+	}
+}
+
+func TestSourceIsLossless(t *testing.T) {
+	inputs := []string{
+		"+ 1 2",
+		"  x = 0x1F  # hex\n\n/* multi\n   line */ × x √ 4\t\n",
+		"def f(a, b) = (\n  a ^ b ;; // 7 2\n) /**/",
+		"x = 1 # one\r\n* x 2\r\n",
+	}
+
+	for _, input := range inputs {
+		l, err := NewLexer(input, WithTrivia())
+		if err != nil {
+			t.Fatalf("An error while lexing `%s`! %v", input, err)
+		}
+		if got := l.Source(); got != input {
+			t.Errorf("Expected the source `%s`, got `%s`!", input, got)
+		}
+	}
+}
@@ -2,6 +2,9 @@ package parser
 
 import (
 	"fmt"
+	"strings"
+
+	"github.com/sheikhartin/bytecode-based-calculator/pkg/bytecode"
 )
 
 type ASTNode interface {
@@ -21,11 +24,26 @@ func (n NumberNode) String() string {
 }
 
 func (n NumberNode) GenerateBytecode(g *BytecodeGenerator) {
-	g.Emit("PUSH_NUM", n.Value)
+	g.EmitConstant(n.Value)
+}
+
+type QuantityNode struct {
+	Number *NumberNode
+	Unit   string
+}
+
+func (n QuantityNode) String() string {
+	return fmt.Sprintf("QuantityNode{Number: %s, Unit: %s}", n.Number, n.Unit)
+}
+
+func (n QuantityNode) GenerateBytecode(g *BytecodeGenerator) {
+	g.generateNode(n.Number)
+	g.EmitName(bytecode.APPLY_UNIT, n.Unit)
 }
 
 type IdentifierNode struct {
-	Value string
+	Value   string
+	Binding Binding
 }
 
 func (n IdentifierNode) String() string {
@@ -33,7 +51,7 @@ func (n IdentifierNode) String() string {
 }
 
 func (n IdentifierNode) GenerateBytecode(g *BytecodeGenerator) {
-	g.Emit("LOAD_VAR", n.Value)
+	g.EmitLoad(n)
 }
 
 type CallNode struct {
@@ -47,9 +65,10 @@ func (n CallNode) String() string {
 
 func (n CallNode) GenerateBytecode(g *BytecodeGenerator) {
 	for _, arg := range n.Args {
-		arg.GenerateBytecode(g)
+		g.generateNode(arg)
 	}
-	g.Emit("CALL_FUNC", n.Callee.Value, fmt.Sprintf("%d", len(n.Args)))
+	g.generateNode(n.Callee)
+	g.EmitCall(n.Callee.Value, len(n.Args))
 }
 
 type UnaryOpNode struct {
@@ -62,8 +81,12 @@ func (n UnaryOpNode) String() string {
 }
 
 func (n UnaryOpNode) GenerateBytecode(g *BytecodeGenerator) {
-	n.Operand.GenerateBytecode(g)
-	g.Emit("UNARY_OP", n.Op.String())
+	g.generateNode(n.Operand)
+	if isBitwiseOperator(n.Op) {
+		g.EmitOperator(bytecode.BITWISE_OP, n.Op)
+	} else {
+		g.EmitOperator(bytecode.UNARY_OP, n.Op)
+	}
 }
 
 type BinaryOpNode struct {
@@ -77,9 +100,138 @@ func (n BinaryOpNode) String() string {
 }
 
 func (n BinaryOpNode) GenerateBytecode(g *BytecodeGenerator) {
-	n.Left.GenerateBytecode(g)
-	n.Right.GenerateBytecode(g)
-	g.Emit("BINARY_OP", n.Op.String())
+	if isLogicalOperator(n.Op) {
+		n.generateShortCircuit(g)
+		return
+	}
+	g.generateNode(n.Left)
+	g.generateNode(n.Right)
+	if isComparisonOperator(n.Op) {
+		g.EmitOperator(bytecode.COMPARE, n.Op)
+	} else if n.Op == TO {
+		g.Emit(bytecode.CONVERT)
+	} else if isBitwiseOperator(n.Op) {
+		g.EmitOperator(bytecode.BITWISE_OP, n.Op)
+	} else {
+		g.EmitOperator(bytecode.BINARY_OP, n.Op)
+	}
+}
+
+// `and` jumps out as soon as an operand is false and `or` as soon as one is
+// true; the right operand is only evaluated when it can change the result.
+func (n BinaryOpNode) generateShortCircuit(g *BytecodeGenerator) {
+	jump, decided := bytecode.JUMP_IF_FALSE, false
+	if n.Op == OR {
+		jump, decided = bytecode.JUMP_IF_TRUE, true
+	}
+	decidedLabel, endLabel := g.NewLabel(), g.NewLabel()
+	g.generateNode(n.Left)
+	g.EmitJump(jump, decidedLabel)
+	g.generateNode(n.Right)
+	g.EmitJump(jump, decidedLabel)
+	g.EmitBool(!decided)
+	g.EmitJump(bytecode.JUMP, endLabel)
+	g.MarkLabel(decidedLabel)
+	g.EmitBool(decided)
+	g.MarkLabel(endLabel)
+}
+
+type ConditionalNode struct {
+	Cond ExprNode
+	Then ExprNode
+	Else ExprNode
+}
+
+func (n ConditionalNode) String() string {
+	return fmt.Sprintf("ConditionalNode{Cond: %s, Then: %s, Else: %s}", n.Cond, n.Then, n.Else)
+}
+
+func (n ConditionalNode) GenerateBytecode(g *BytecodeGenerator) {
+	elseLabel, endLabel := g.NewLabel(), g.NewLabel()
+	g.generateNode(n.Cond)
+	g.EmitJump(bytecode.JUMP_IF_FALSE, elseLabel)
+	g.generateNode(n.Then)
+	g.EmitJump(bytecode.JUMP, endLabel)
+	g.MarkLabel(elseLabel)
+	g.generateNode(n.Else)
+	g.MarkLabel(endLabel)
+}
+
+type SeriesNode struct {
+	Op    TokenKind
+	Index *IdentifierNode
+	Lower ExprNode
+	Upper ExprNode
+	Body  ExprNode
+}
+
+func (n SeriesNode) String() string {
+	return fmt.Sprintf(
+		"SeriesNode{Op: %s, Index: %s, Lower: %s, Upper: %s, Body: %s}",
+		n.Op,
+		n.Index,
+		n.Lower,
+		n.Upper,
+		n.Body,
+	)
+}
+
+// The bounds are evaluated once in the enclosing scope, then the body runs in
+// a fresh scope where the index is bound to each value from lower to upper.
+// Every value gets a scope of its own, so that closures made in the body keep
+// the index they saw.
+func (n SeriesNode) GenerateBytecode(g *BytecodeGenerator) {
+	index, upper := *n.Index, IdentifierNode{Value: seriesUpper, Binding: Binding{Local: true, Slot: 1}}
+	op, identity := TokenKind(ADD), "0"
+	if n.Op == PROD {
+		op, identity = MUL, "1"
+	}
+	loopLabel, endLabel := g.NewLabel(), g.NewLabel()
+
+	g.generateNode(n.Lower)
+	g.generateNode(n.Upper)
+	g.EmitScope(2)
+	g.EmitStore(upper)
+	g.EmitStore(index)
+	g.EmitConstant(identity)
+
+	g.MarkLabel(loopLabel)
+	g.EmitLoad(index)
+	g.EmitLoad(upper)
+	g.EmitOperator(bytecode.COMPARE, LE)
+	g.EmitJump(bytecode.JUMP_IF_FALSE, endLabel)
+	g.generateNode(n.Body)
+	g.EmitOperator(bytecode.BINARY_OP, op)
+	g.EmitLoad(index)
+	g.EmitConstant("1")
+	g.EmitOperator(bytecode.BINARY_OP, ADD)
+	g.EmitLoad(upper)
+	g.Emit(bytecode.POP_SCOPE)
+	g.EmitScope(2)
+	g.EmitStore(upper)
+	g.EmitStore(index)
+	g.EmitJump(bytecode.JUMP, loopLabel)
+
+	g.MarkLabel(endLabel)
+	g.Emit(bytecode.POP_SCOPE)
+}
+
+type LetNode struct {
+	Variable *IdentifierNode
+	Value    ExprNode
+	Body     ExprNode
+}
+
+func (n LetNode) String() string {
+	return fmt.Sprintf("LetNode{Variable: %s, Value: %s, Body: %s}", n.Variable, n.Value, n.Body)
+}
+
+func (n LetNode) GenerateBytecode(g *BytecodeGenerator) {
+	g.generateNode(n.Value)
+	g.EmitScope(1)
+	g.EmitStore(*n.Variable)
+	g.generateNode(n.Body)
+	g.Emit(bytecode.POP_SCOPE)
 }
 
 type StmtNode interface {
@@ -96,6 +248,88 @@ func (n VariableDeclNode) String() string {
 }
 
 func (n VariableDeclNode) GenerateBytecode(g *BytecodeGenerator) {
-	n.Value.GenerateBytecode(g)
-	g.Emit("STORE_VAR", n.Variable.Value)
+	g.generateNode(n.Value)
+	g.EmitStore(*n.Variable)
+}
+
+type ConstDeclNode struct {
+	Variable *IdentifierNode
+	Value    ExprNode
+}
+
+func (n ConstDeclNode) String() string {
+	return fmt.Sprintf("ConstDeclNode{Variable: %s, Value: %s}", n.Variable, n.Value)
+}
+
+func (n ConstDeclNode) GenerateBytecode(g *BytecodeGenerator) {
+	g.generateNode(n.Value)
+	g.EmitSlot(bytecode.STORE_CONST, *n.Variable)
+}
+
+type FunctionDeclNode struct {
+	Name   *IdentifierNode
+	Params []*IdentifierNode
+	Body   ExprNode
+}
+
+func (n FunctionDeclNode) String() string {
+	return fmt.Sprintf("FunctionDeclNode{Name: %s, Params: %s, Body: %s}", n.Name, n.Params, n.Body)
+}
+
+func (n FunctionDeclNode) GenerateBytecode(g *BytecodeGenerator) {
+	g.EmitFunction(n.Name.Value, n.Params, n.Body)
+	g.EmitStore(*n.Name)
+}
+
+type LambdaNode struct {
+	Params []*IdentifierNode
+	Body   ExprNode
+}
+
+func (n LambdaNode) String() string {
+	return fmt.Sprintf("LambdaNode{Params: %s, Body: %s}", n.Params, n.Body)
+}
+
+func (n LambdaNode) GenerateBytecode(g *BytecodeGenerator) {
+	g.EmitFunction("", n.Params, n.Body)
+}
+
+type OperatorNode struct {
+	Op TokenKind
+}
+
+func (n OperatorNode) String() string {
+	return fmt.Sprintf("OperatorNode{Op: %s}", n.Op)
+}
+
+func (n OperatorNode) GenerateBytecode(g *BytecodeGenerator) {
+	if isBitwiseOperator(n.Op) {
+		g.EmitOperator(bytecode.BITWISE_OP, n.Op)
+	} else if isUnaryOperator(n.Op) {
+		g.EmitOperator(bytecode.UNARY_OP, n.Op)
+	} else if isComparisonOperator(n.Op) {
+		g.EmitOperator(bytecode.COMPARE, n.Op)
+	} else if n.Op == TO {
+		g.Emit(bytecode.CONVERT)
+	} else {
+		g.EmitOperator(bytecode.BINARY_OP, n.Op)
+	}
+}
+
+type StackOpNode struct {
+	Word string
+}
+
+func (n StackOpNode) String() string {
+	return fmt.Sprintf("StackOpNode{Word: %s}", n.Word)
+}
+
+// The postfix parser only makes nodes of the stack words, so any other word
+// is a bug in whoever built the tree.
+func (n StackOpNode) GenerateBytecode(g *BytecodeGenerator) {
+	op, ok := bytecode.LookupOpcode(strings.ToUpper(n.Word))
+	if !ok || !isStackWord(n.Word) {
+		panic(fmt.Sprintf("Unknown stack word: %s", n.Word))
+	}
+	g.Emit(op)
 }
@@ -3,13 +3,37 @@ package parser
 import (
 	"fmt"
 	"strings"
+
+	"github.com/sheikhartin/bytecode-based-calculator/pkg/units"
 )
 
+// Positions holds where each node starts in the source, including the nodes
+// inside of others. The parser also keeps track of the names that are bound
+// where it is, which are variables rather than units.
 type Parser struct {
-	tokens  []Token
-	currTok Token
-	nextTok Token
-	Nodes   []ASTNode
+	tokens    []Token
+	currTok   Token
+	nextTok   Token
+	locals    []string
+	globals   map[string]bool
+	Nodes     []ASTNode
+	Positions map[ASTNode]Position
+}
+
+type ParserOption func(*Parser)
+
+// WithVariables starts the parser with the names that earlier programs have
+// assigned, like the previous lines of the REPL, so that they hide units the
+// same way as the names assigned in the source itself.
+func WithVariables(names []string) ParserOption {
+	return func(p *Parser) {
+		if p.globals == nil {
+			p.globals = map[string]bool{}
+		}
+		for _, name := range names {
+			p.globals[name] = true
+		}
+	}
 }
 
 func (p Parser) String() string {
@@ -39,6 +63,19 @@ func (p *Parser) advance() {
 	}
 }
 
+// A node keeps the first position it is marked with, which is the one of the
+// innermost parse that created it.
+func (p *Parser) mark(node ASTNode, pos Position) {
+	if node == nil {
+		return
+	} else if p.Positions == nil {
+		p.Positions = map[ASTNode]Position{}
+	}
+	if _, ok := p.Positions[node]; !ok {
+		p.Positions[node] = pos
+	}
+}
+
 func (p *Parser) expectKind(expected TokenKind) error {
 	if p.currTok.Kind != expected {
 		return fmt.Errorf("Expected `%s`, got `%s`!", expected, p.currTok.Kind)
@@ -47,9 +84,52 @@ func (p *Parser) expectKind(expected TokenKind) error {
 	return nil
 }
 
-func (p *Parser) parseNumber() (*NumberNode, error) {
+func (p *Parser) isVariable(name string) bool {
+	for _, local := range p.locals {
+		if local == name {
+			return true
+		}
+	}
+	return p.globals[name]
+}
+
+// The names of parameters, `let` and series only hide units while their body
+// is parsed.
+func (p *Parser) parseScoped(names []*IdentifierNode, parse func() (ExprNode, error)) (ExprNode, error) {
+	outer := p.locals
+	for _, name := range names {
+		p.locals = append(p.locals, name.Value)
+	}
+	defer func() { p.locals = outer }()
+	return parse()
+}
+
+// Assigned names are variables in every statement after their assignment.
+func (p *Parser) declare(node ASTNode) {
+	if p.globals == nil {
+		p.globals = map[string]bool{}
+	}
+	switch n := node.(type) {
+	case *VariableDeclNode:
+		p.globals[n.Variable.Value] = true
+	case *ConstDeclNode:
+		p.globals[n.Variable.Value] = true
+	case *FunctionDeclNode:
+		p.globals[n.Name.Value] = true
+	}
+}
+
+// A unit right after a number on the same line is part of a quantity literal
+// like `3 m`, unless a variable of that name is in scope.
+func (p *Parser) parseNumber() (ExprNode, error) {
 	num := &NumberNode{Value: p.currTok.Value}
+	row := p.currTok.Pos.Row
 	p.advance()
+	if p.currTok.Kind == IDENT && p.currTok.Pos.Row == row && units.IsUnit(p.currTok.Value) && !p.isVariable(p.currTok.Value) {
+		quantity := &QuantityNode{Number: num, Unit: p.currTok.Value}
+		p.advance()
+		return quantity, nil
+	}
 	return num, nil
 }
 
@@ -111,8 +191,117 @@ func (p *Parser) parseCall() (*CallNode, error) {
 	return &CallNode{Callee: callee, Args: args}, nil
 }
 
+func (p *Parser) parseLambda() (*LambdaNode, error) {
+	if err := p.expectKind(FN); err != nil {
+		return nil, err
+	}
+	params, err := p.parseParameters()
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.parseScoped(params, p.parseExpression)
+	if err != nil {
+		return nil, err
+	} else if body == nil {
+		return nil, fmt.Errorf(
+			"Expected a lambda body at line %d, column %d.",
+			p.currTok.Pos.Row,
+			p.currTok.Pos.Col,
+		)
+	}
+	return &LambdaNode{Params: params, Body: body}, nil
+}
+
+func (p *Parser) parseSeriesWith(parseArg func() (ExprNode, error)) (*SeriesNode, error) {
+	op := p.currTok.Kind
+	p.advance()
+	if err := p.expectKind(LPAREN); err != nil {
+		return nil, err
+	} else if p.currTok.Kind != IDENT {
+		return nil, fmt.Errorf(
+			"Expected an index variable for `%s` at line %d, column %d.",
+			op,
+			p.currTok.Pos.Row,
+			p.currTok.Pos.Col,
+		)
+	}
+	index := p.parseIdentifier()
+
+	var args [3]ExprNode
+	for i, part := range []string{"lower bound", "upper bound", "body"} {
+		if err := p.expectKind(COMMA); err != nil {
+			return nil, err
+		}
+		var arg ExprNode
+		var err error
+		if part == "body" {
+			arg, err = p.parseScoped([]*IdentifierNode{index}, parseArg)
+		} else {
+			arg, err = parseArg()
+		}
+		if err != nil {
+			return nil, err
+		} else if arg == nil {
+			return nil, fmt.Errorf(
+				"Expected a %s for `%s` at line %d, column %d.",
+				part,
+				op,
+				p.currTok.Pos.Row,
+				p.currTok.Pos.Col,
+			)
+		}
+		args[i] = arg
+	}
+	if err := p.expectKind(RPAREN); err != nil {
+		return nil, err
+	}
+	return &SeriesNode{Op: op, Index: index, Lower: args[0], Upper: args[1], Body: args[2]}, nil
+}
+
+func (p *Parser) parseLetWith(parseValue, parseBody func() (ExprNode, error)) (*LetNode, error) {
+	if err := p.expectKind(LET); err != nil {
+		return nil, err
+	} else if p.currTok.Kind != IDENT {
+		return nil, fmt.Errorf(
+			"Expected a variable name after `let` at line %d, column %d.",
+			p.currTok.Pos.Row,
+			p.currTok.Pos.Col,
+		)
+	}
+	variable := p.parseIdentifier()
+	if err := p.expectKind(EQUAL); err != nil {
+		return nil, err
+	}
+
+	value, err := parseValue()
+	if err != nil {
+		return nil, err
+	} else if value == nil {
+		return nil, fmt.Errorf(
+			"Expected a value for `%s` at line %d, column %d.",
+			variable.Value,
+			p.currTok.Pos.Row,
+			p.currTok.Pos.Col,
+		)
+	} else if err := p.expectKind(IN); err != nil {
+		return nil, err
+	}
+
+	body, err := p.parseScoped([]*IdentifierNode{variable}, parseBody)
+	if err != nil {
+		return nil, err
+	} else if body == nil {
+		return nil, fmt.Errorf(
+			"Expected a body for `let` at line %d, column %d.",
+			p.currTok.Pos.Row,
+			p.currTok.Pos.Col,
+		)
+	}
+	return &LetNode{Variable: variable, Value: value, Body: body}, nil
+}
+
 func isUnaryOperator(kind TokenKind) bool {
-	return kind == FACT
+	return kind == FACT || kind == NOT || kind == BNOT || kind == SQRT
 }
 
 func (p *Parser) parseUnaryOperation() (ExprNode, error) {
@@ -125,9 +314,47 @@ func (p *Parser) parseUnaryOperation() (ExprNode, error) {
 	return &UnaryOpNode{Operand: expr, Op: op}, nil
 }
 
+func (p *Parser) parseConditional() (*ConditionalNode, error) {
+	if err := p.expectKind(COND); err != nil {
+		return nil, err
+	}
+	var branches [3]ExprNode
+	for i, part := range []string{"condition", "consequent", "alternative"} {
+		expr, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		} else if expr == nil {
+			return nil, fmt.Errorf(
+				"Expected a %s for the conditional at line %d, column %d.",
+				part,
+				p.currTok.Pos.Row,
+				p.currTok.Pos.Col,
+			)
+		}
+		branches[i] = expr
+	}
+	return &ConditionalNode{Cond: branches[0], Then: branches[1], Else: branches[2]}, nil
+}
+
+func isComparisonOperator(kind TokenKind) bool {
+	return kind == LT || kind == LE || kind == GT ||
+		kind == GE || kind == EQ || kind == NE
+}
+
+func isLogicalOperator(kind TokenKind) bool {
+	return kind == AND || kind == OR
+}
+
+func isBitwiseOperator(kind TokenKind) bool {
+	return kind == BAND || kind == BOR || kind == BXOR ||
+		kind == BNOT || kind == SHL || kind == SHR
+}
+
 func isBinaryOperator(kind TokenKind) bool {
 	return kind == ADD || kind == SUB || kind == MUL ||
-		kind == DIV || kind == MOD || kind == POW
+		kind == DIV || kind == IDIV || kind == MOD || kind == POW ||
+		isComparisonOperator(kind) || isLogicalOperator(kind) ||
+		(isBitwiseOperator(kind) && kind != BNOT) || kind == TO
 }
 
 func (p *Parser) parseBinaryOperation() (ExprNode, error) {
@@ -147,6 +374,10 @@ func (p *Parser) parseBinaryOperation() (ExprNode, error) {
 	right, err := p.parseExpression()
 	if err != nil {
 		return nil, err
+	} else if quantity, ok := left.(*QuantityNode); ok && right == nil {
+		// A bare unit stands for one of it, so `/ 2 s` divides by a second
+		// instead of missing the operand the quantity took.
+		left, right = quantity.Number, &IdentifierNode{Value: quantity.Unit}
 	} else if right == nil {
 		return nil, fmt.Errorf(
 			"Expected a right-hand operand for the `%s` operator at line %d, column %d.",
@@ -163,24 +394,49 @@ func (p *Parser) parseTerm() (ExprNode, error) {
 		return p.parseGroupedExpression()
 	} else if p.currTok.Kind == IDENT && p.nextTok.Kind == LPAREN {
 		return p.parseCall()
+	} else if p.currTok.Kind == FN {
+		return p.parseLambda()
+	} else if p.currTok.Kind == SUM || p.currTok.Kind == PROD {
+		return p.parseSeriesWith(p.parseExpression)
+	} else if p.currTok.Kind == LET {
+		return p.parseLetWith(p.parseExpression, p.parseExpression)
 	} else if isUnaryOperator(p.currTok.Kind) {
 		return p.parseUnaryOperation()
 	}
 	return p.parseAtomic()
 }
 
-func (p *Parser) parseExpression() (ExprNode, error) {
-	if isBinaryOperator(p.currTok.Kind) {
+func (p *Parser) parseExpression() (node ExprNode, err error) {
+	pos := p.currTok.Pos
+	defer func() {
+		if err == nil {
+			p.mark(node, pos)
+		}
+	}()
+
+	if p.currTok.Kind == COND {
+		return p.parseConditional()
+	} else if isBinaryOperator(p.currTok.Kind) {
 		return p.parseBinaryOperation()
 	}
 	return p.parseTerm()
 }
 
+func (p *Parser) atStatementEnd() bool {
+	return p.currTok.Kind == SEMI || p.currTok.Kind == EOF
+}
+
 func (p *Parser) parseFullExpression() (ExprNode, error) {
 	value, err := p.parseExpression()
 	if err != nil {
 		return nil, err
-	} else if p.currTok.Kind != EOF {
+	} else if value == nil {
+		return nil, fmt.Errorf(
+			"Invalid grammar in position %d and %d.",
+			p.currTok.Pos.Row,
+			p.currTok.Pos.Col,
+		)
+	} else if !p.atStatementEnd() {
 		return nil, fmt.Errorf(
 			"Unexpected token `%s` found after expression at line %d, column %d.",
 			p.currTok.Value,
@@ -203,30 +459,117 @@ func (p *Parser) parseVariableDeclaration() (*VariableDeclNode, error) {
 	return &VariableDeclNode{Variable: variable, Value: value}, nil
 }
 
-func (p *Parser) parseStatement() (StmtNode, error) {
-	if p.currTok.Kind == IDENT && p.nextTok.Kind == EQUAL {
-		return p.parseVariableDeclaration()
+// A constant is declared like a variable, so every notation passes in its own
+// way of parsing the declaration after the keyword.
+func (p *Parser) parseConstantDeclaration(parseDecl func() (*VariableDeclNode, error)) (*ConstDeclNode, error) {
+	pos := p.currTok.Pos
+	if err := p.expectKind(CONST); err != nil {
+		return nil, err
+	} else if p.currTok.Kind != IDENT || p.nextTok.Kind != EQUAL {
+		return nil, fmt.Errorf(
+			"Expected `name = value` after `const` at line %d, column %d.",
+			pos.Row,
+			pos.Col,
+		)
 	}
-	return nil, nil
+	decl, err := parseDecl()
+	if err != nil {
+		return nil, err
+	}
+	return &ConstDeclNode{Variable: decl.Variable, Value: decl.Value}, nil
 }
 
-func (p *Parser) Parse() error {
-	p.advance()
-	stmt, err := p.parseStatement()
+func (p *Parser) parseParameters() ([]*IdentifierNode, error) {
+	if err := p.expectKind(LPAREN); err != nil {
+		return nil, err
+	}
+
+	var params []*IdentifierNode
+	seen := map[string]bool{}
+	for p.currTok.Kind == IDENT {
+		if seen[p.currTok.Value] {
+			return nil, fmt.Errorf(
+				"Duplicate parameter `%s` at line %d, column %d.",
+				p.currTok.Value,
+				p.currTok.Pos.Row,
+				p.currTok.Pos.Col,
+			)
+		}
+		seen[p.currTok.Value] = true
+		params = append(params, p.parseIdentifier())
+		if p.currTok.Kind != COMMA {
+			break
+		}
+		p.advance()
+	}
+	if err := p.expectKind(RPAREN); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+func (p *Parser) parseFunctionSignature() (*IdentifierNode, []*IdentifierNode, error) {
+	if err := p.expectKind(DEF); err != nil {
+		return nil, nil, err
+	} else if p.currTok.Kind != IDENT {
+		return nil, nil, fmt.Errorf(
+			"Expected a function name at line %d, column %d.",
+			p.currTok.Pos.Row,
+			p.currTok.Pos.Col,
+		)
+	}
+	name := p.parseIdentifier()
+	params, err := p.parseParameters()
 	if err != nil {
-		return err
-	} else if stmt != nil {
-		p.Nodes = append(p.Nodes, stmt)
+		return nil, nil, err
+	} else if err := p.expectKind(EQUAL); err != nil {
+		return nil, nil, err
 	}
+	return name, params, nil
+}
 
-	expr, err := p.parseFullExpression()
+func (p *Parser) parseFunctionDeclaration() (*FunctionDeclNode, error) {
+	name, params, err := p.parseFunctionSignature()
 	if err != nil {
-		return err
-	} else if expr != nil {
-		p.Nodes = append(p.Nodes, expr)
+		return nil, err
+	}
+	body, err := p.parseScoped(params, p.parseFullExpression)
+	if err != nil {
+		return nil, err
+	}
+	return &FunctionDeclNode{Name: name, Params: params, Body: body}, nil
+}
+
+func (p *Parser) parseStatement() (ASTNode, error) {
+	if p.currTok.Kind == DEF {
+		return p.parseFunctionDeclaration()
+	} else if p.currTok.Kind == CONST {
+		return p.parseConstantDeclaration(p.parseVariableDeclaration)
+	} else if p.currTok.Kind == IDENT && p.nextTok.Kind == EQUAL {
+		return p.parseVariableDeclaration()
+	}
+	return p.parseFullExpression()
+}
+
+func (p *Parser) parseProgram(parseStatement func() ([]ASTNode, error)) error {
+	for p.advance(); p.currTok.Kind != EOF; {
+		if p.currTok.Kind == SEMI {
+			p.advance()
+			continue
+		}
+		pos := p.currTok.Pos
+		nodes, err := parseStatement()
+		if err != nil {
+			return err
+		}
+		p.Nodes = append(p.Nodes, nodes...)
+		for _, node := range nodes {
+			p.mark(node, pos)
+			p.declare(node)
+		}
 	}
 
-	if stmt == nil && expr == nil {
+	if len(p.Nodes) == 0 {
 		return fmt.Errorf(
 			"Invalid grammar in position %d and %d.",
 			p.currTok.Pos.Row,
@@ -236,7 +579,17 @@ func (p *Parser) Parse() error {
 	return nil
 }
 
-func NewParser(tokens []Token) (*Parser, error) {
+func (p *Parser) Parse() error {
+	return p.parseProgram(func() ([]ASTNode, error) {
+		node, err := p.parseStatement()
+		return []ASTNode{node}, err
+	})
+}
+
+func NewParser(tokens []Token, options ...ParserOption) (*Parser, error) {
 	p := &Parser{tokens: tokens}
+	for _, option := range options {
+		option(p)
+	}
 	return p, p.Parse()
 }
@@ -144,3 +144,389 @@ func TestParseVariableDeclaration(t *testing.T) {
 		}
 	}
 }
+
+func TestParseConstantDeclaration(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []ASTNode
+	}{
+		{"const g = 9.81", []ASTNode{
+			&ConstDeclNode{
+				Variable: &IdentifierNode{Value: "g"},
+				Value:    &NumberNode{Value: "9.81"},
+			},
+		}},
+		{"const tau = * 2 PI", []ASTNode{
+			&ConstDeclNode{
+				Variable: &IdentifierNode{Value: "tau"},
+				Value: &BinaryOpNode{
+					Left:  &NumberNode{Value: "2"},
+					Op:    MUL,
+					Right: &IdentifierNode{Value: "PI"},
+				},
+			},
+		}},
+	}
+
+	for _, tt := range tests {
+		l, err := NewLexer(tt.input)
+		if err != nil {
+			t.Fatalf("Failed to tokenize input `%s`: %v", tt.input, err)
+		}
+		p, err := NewParser(l.Tokens)
+		if err != nil {
+			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", tt.input, err)
+		}
+		if !reflect.DeepEqual(p.Nodes, tt.want) {
+			t.Errorf("Failed to parse constant declaration. Got `%v`, expected `%v`.", p.Nodes, tt.want)
+		}
+	}
+}
+
+func TestParseConstantDeclarationErrors(t *testing.T) {
+	inputs := []string{"const", "const g", "const 5 = 3", "const g 9.81"}
+
+	for _, input := range inputs {
+		l, err := NewLexer(input)
+		if err != nil {
+			t.Fatalf("Failed to tokenize input `%s`: %v", input, err)
+		}
+		if _, err := NewParser(l.Tokens); err == nil {
+			t.Errorf("Expected a syntax error for input `%s`.", input)
+		}
+	}
+}
+
+func TestParsePrograms(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []ASTNode
+	}{
+		{"x = 2 ;; * x 3", []ASTNode{
+			&VariableDeclNode{
+				Variable: &IdentifierNode{Value: "x"},
+				Value:    &NumberNode{Value: "2"},
+			},
+			&BinaryOpNode{
+				Left:  &IdentifierNode{Value: "x"},
+				Op:    MUL,
+				Right: &NumberNode{Value: "3"},
+			},
+		}},
+		{"\n1\n\n;; 2\n", []ASTNode{
+			&NumberNode{Value: "1"},
+			&NumberNode{Value: "2"},
+		}},
+	}
+
+	for _, tt := range tests {
+		l, err := NewLexer(tt.input)
+		if err != nil {
+			t.Fatalf("Failed to tokenize input `%s`: %v", tt.input, err)
+		}
+		p, err := NewParser(l.Tokens)
+		if err != nil {
+			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", tt.input, err)
+		}
+		if !reflect.DeepEqual(p.Nodes, tt.want) {
+			t.Errorf("Failed to parse program. Got `%v`, expected `%v`.", p.Nodes, tt.want)
+		}
+	}
+}
+
+func TestParseProgramErrors(t *testing.T) {
+	inputs := []string{"", ";;", "+ 1 ;; 2", "1 2"}
+
+	for _, input := range inputs {
+		l, err := NewLexer(input)
+		if err != nil {
+			t.Fatalf("Failed to tokenize input `%s`: %v", input, err)
+		}
+		if _, err := NewParser(l.Tokens); err == nil {
+			t.Errorf("Expected a syntax error for input `%s`.", input)
+		}
+	}
+}
+
+func TestParseFunctionDeclaration(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []ASTNode
+	}{
+		{"def hyp(a, b) = ^ + ^ a 2 ^ b 2 0.5", []ASTNode{
+			&FunctionDeclNode{
+				Name:   &IdentifierNode{Value: "hyp"},
+				Params: []*IdentifierNode{{Value: "a"}, {Value: "b"}},
+				Body: &BinaryOpNode{
+					Left: &BinaryOpNode{
+						Left: &BinaryOpNode{
+							Left:  &IdentifierNode{Value: "a"},
+							Op:    POW,
+							Right: &NumberNode{Value: "2"},
+						},
+						Op: ADD,
+						Right: &BinaryOpNode{
+							Left:  &IdentifierNode{Value: "b"},
+							Op:    POW,
+							Right: &NumberNode{Value: "2"},
+						},
+					},
+					Op:    POW,
+					Right: &NumberNode{Value: "0.5"},
+				},
+			},
+		}},
+		{"def seven() = 7", []ASTNode{
+			&FunctionDeclNode{
+				Name: &IdentifierNode{Value: "seven"},
+				Body: &NumberNode{Value: "7"},
+			},
+		}},
+	}
+
+	for _, tt := range tests {
+		l, err := NewLexer(tt.input)
+		if err != nil {
+			t.Fatalf("Failed to tokenize input `%s`: %v", tt.input, err)
+		}
+		p, err := NewParser(l.Tokens)
+		if err != nil {
+			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", tt.input, err)
+		}
+		if !reflect.DeepEqual(p.Nodes, tt.want) {
+			t.Errorf("Failed to parse function declaration. Got `%v`, expected `%v`.", p.Nodes, tt.want)
+		}
+	}
+}
+
+func TestParseLambdas(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []ASTNode
+	}{
+		{"sq = fn(x) * x x", []ASTNode{
+			&VariableDeclNode{
+				Variable: &IdentifierNode{Value: "sq"},
+				Value: &LambdaNode{
+					Params: []*IdentifierNode{{Value: "x"}},
+					Body: &BinaryOpNode{
+						Left:  &IdentifierNode{Value: "x"},
+						Op:    MUL,
+						Right: &IdentifierNode{Value: "x"},
+					},
+				},
+			},
+		}},
+		{"integ(fn(t) t, 0, 1)", []ASTNode{
+			&CallNode{
+				Callee: &IdentifierNode{Value: "integ"},
+				Args: []ExprNode{
+					&LambdaNode{
+						Params: []*IdentifierNode{{Value: "t"}},
+						Body:   &IdentifierNode{Value: "t"},
+					},
+					&NumberNode{Value: "0"},
+					&NumberNode{Value: "1"},
+				},
+			},
+		}},
+	}
+
+	for _, tt := range tests {
+		l, err := NewLexer(tt.input)
+		if err != nil {
+			t.Fatalf("Failed to tokenize input `%s`: %v", tt.input, err)
+		}
+		p, err := NewParser(l.Tokens)
+		if err != nil {
+			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", tt.input, err)
+		}
+		if !reflect.DeepEqual(p.Nodes, tt.want) {
+			t.Errorf("Failed to parse lambda. Got `%v`, expected `%v`.", p.Nodes, tt.want)
+		}
+	}
+}
+
+func TestParseConditionals(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []ASTNode
+	}{
+		{"? x 1 - 0 1", []ASTNode{
+			&ConditionalNode{
+				Cond: &IdentifierNode{Value: "x"},
+				Then: &NumberNode{Value: "1"},
+				Else: &BinaryOpNode{
+					Left:  &NumberNode{Value: "0"},
+					Op:    SUB,
+					Right: &NumberNode{Value: "1"},
+				},
+			},
+		}},
+	}
+
+	for _, tt := range tests {
+		l, err := NewLexer(tt.input)
+		if err != nil {
+			t.Fatalf("Failed to tokenize input `%s`: %v", tt.input, err)
+		}
+		p, err := NewParser(l.Tokens)
+		if err != nil {
+			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", tt.input, err)
+		}
+		if !reflect.DeepEqual(p.Nodes, tt.want) {
+			t.Errorf("Failed to parse conditional. Got `%v`, expected `%v`.", p.Nodes, tt.want)
+		}
+	}
+}
+
+func TestParseSeries(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []ASTNode
+	}{
+		{"sum(i, 1, n, ^ i 2)", []ASTNode{
+			&SeriesNode{
+				Op:    SUM,
+				Index: &IdentifierNode{Value: "i"},
+				Lower: &NumberNode{Value: "1"},
+				Upper: &IdentifierNode{Value: "n"},
+				Body: &BinaryOpNode{
+					Left:  &IdentifierNode{Value: "i"},
+					Op:    POW,
+					Right: &NumberNode{Value: "2"},
+				},
+			},
+		}},
+		{"prod(k, 1, 3, k)", []ASTNode{
+			&SeriesNode{
+				Op:    PROD,
+				Index: &IdentifierNode{Value: "k"},
+				Lower: &NumberNode{Value: "1"},
+				Upper: &NumberNode{Value: "3"},
+				Body:  &IdentifierNode{Value: "k"},
+			},
+		}},
+	}
+
+	for _, tt := range tests {
+		l, err := NewLexer(tt.input)
+		if err != nil {
+			t.Fatalf("Failed to tokenize input `%s`: %v", tt.input, err)
+		}
+		p, err := NewParser(l.Tokens)
+		if err != nil {
+			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", tt.input, err)
+		}
+		if !reflect.DeepEqual(p.Nodes, tt.want) {
+			t.Errorf("Failed to parse series. Got `%v`, expected `%v`.", p.Nodes, tt.want)
+		}
+	}
+}
+
+func TestParseLetBindings(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []ASTNode
+	}{
+		{"let x = + 1 2 in * x x", []ASTNode{
+			&LetNode{
+				Variable: &IdentifierNode{Value: "x"},
+				Value: &BinaryOpNode{
+					Left:  &NumberNode{Value: "1"},
+					Op:    ADD,
+					Right: &NumberNode{Value: "2"},
+				},
+				Body: &BinaryOpNode{
+					Left:  &IdentifierNode{Value: "x"},
+					Op:    MUL,
+					Right: &IdentifierNode{Value: "x"},
+				},
+			},
+		}},
+	}
+
+	for _, tt := range tests {
+		l, err := NewLexer(tt.input)
+		if err != nil {
+			t.Fatalf("Failed to tokenize input `%s`: %v", tt.input, err)
+		}
+		p, err := NewParser(l.Tokens)
+		if err != nil {
+			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", tt.input, err)
+		}
+		if !reflect.DeepEqual(p.Nodes, tt.want) {
+			t.Errorf("Failed to parse let binding. Got `%v`, expected `%v`.", p.Nodes, tt.want)
+		}
+	}
+}
+
+func TestParseQuantities(t *testing.T) {
+	tests := []struct {
+		input     string
+		variables []string
+		want      ASTNode
+	}{
+		{"3 m", nil, &QuantityNode{Number: &NumberNode{Value: "3"}, Unit: "m"}},
+		{"/ 2 s", nil, &BinaryOpNode{Left: &NumberNode{Value: "2"}, Op: DIV, Right: &IdentifierNode{Value: "s"}}},
+		{"* 2 s 1 s", nil, &BinaryOpNode{
+			Left:  &QuantityNode{Number: &NumberNode{Value: "2"}, Unit: "s"},
+			Op:    MUL,
+			Right: &QuantityNode{Number: &NumberNode{Value: "1"}, Unit: "s"},
+		}},
+		{"let s = 3 in + * 2 s 1", nil, &LetNode{
+			Variable: &IdentifierNode{Value: "s"},
+			Value:    &NumberNode{Value: "3"},
+			Body: &BinaryOpNode{
+				Left:  &BinaryOpNode{Left: &NumberNode{Value: "2"}, Op: MUL, Right: &IdentifierNode{Value: "s"}},
+				Op:    ADD,
+				Right: &NumberNode{Value: "1"},
+			},
+		}},
+		{"+ * 2 s 1", []string{"s"}, &BinaryOpNode{
+			Left:  &BinaryOpNode{Left: &NumberNode{Value: "2"}, Op: MUL, Right: &IdentifierNode{Value: "s"}},
+			Op:    ADD,
+			Right: &NumberNode{Value: "1"},
+		}},
+	}
+
+	for _, tt := range tests {
+		l, err := NewLexer(tt.input)
+		if err != nil {
+			t.Fatalf("Failed to tokenize input `%s`: %v", tt.input, err)
+		}
+		p, err := NewParser(l.Tokens, WithVariables(tt.variables))
+		if err != nil {
+			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", tt.input, err)
+		}
+		if !reflect.DeepEqual(p.Nodes[len(p.Nodes)-1], tt.want) {
+			t.Errorf("Failed to parse quantities. Got `%v`, expected `%v`.", p.Nodes[len(p.Nodes)-1], tt.want)
+		}
+	}
+}
+
+func TestStatementPositions(t *testing.T) {
+	input := "x = 1 ;; y = 2\n\n  + x y"
+	l, err := NewLexer(input)
+	if err != nil {
+		t.Fatalf("Failed to tokenize input `%s`: %v", input, err)
+	}
+	p, err := NewParser(l.Tokens)
+	if err != nil {
+		t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", input, err)
+	}
+
+	want := []Position{{Row: 1, Col: 1}, {Row: 1, Col: 10}, {Row: 3, Col: 3}}
+	var got []Position
+	for _, node := range p.Nodes {
+		got = append(got, p.Positions[node])
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the positions %v, got %v!", want, got)
+	}
+
+	sum := p.Nodes[2].(*BinaryOpNode)
+	if got, want := p.Positions[sum.Right], (Position{Row: 3, Col: 7}); got != want {
+		t.Errorf("Expected the position %v for the operand `y`, got %v!", want, got)
+	}
+}
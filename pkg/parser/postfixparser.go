@@ -0,0 +1,277 @@
+package parser
+
+import (
+	"fmt"
+)
+
+type PostfixParser struct {
+	Parser
+}
+
+func isStackWord(value string) bool {
+	return value == "dup" || value == "swap" || value == "drop" ||
+		value == "over" || value == "clear"
+}
+
+func isStatementEnd(kind TokenKind) bool {
+	return kind == SEMI || kind == EOF
+}
+
+func isArgumentEnd(kind TokenKind) bool {
+	return kind == COMMA || kind == RPAREN || isStatementEnd(kind)
+}
+
+func arity(kind TokenKind) int {
+	if isUnaryOperator(kind) {
+		return 1
+	}
+	return 2
+}
+
+// Operands that are already known are folded into regular expression nodes;
+// anything that needs values from a previous line is left to the VM stack.
+func (p *PostfixParser) parseSequence(stop func(TokenKind) bool) ([]ASTNode, []ExprNode, error) {
+	var nodes []ASTNode
+	var pending []ExprNode
+	flush := func() {
+		for _, expr := range pending {
+			nodes = append(nodes, expr)
+		}
+		pending = nil
+	}
+
+	for !stop(p.currTok.Kind) {
+		// Whatever the token adds is marked at it; the nodes from earlier
+		// tokens keep the positions they already have.
+		pos := p.currTok.Pos
+		switch {
+		case p.currTok.Kind == NUM:
+			num, _ := p.parseNumber()
+			pending = append(pending, num)
+		case p.currTok.Kind == FN:
+			lambda, err := p.parseLambda()
+			if err != nil {
+				return nil, nil, err
+			}
+			pending = append(pending, lambda)
+		case p.currTok.Kind == SUM || p.currTok.Kind == PROD:
+			series, err := p.parseSeriesWith(func() (ExprNode, error) {
+				return p.parseExpression(isArgumentEnd)
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			pending = append(pending, series)
+		case p.currTok.Kind == LET:
+			let, err := p.parseLetWith(
+				func() (ExprNode, error) {
+					return p.parseExpression(func(kind TokenKind) bool {
+						return kind == IN || isArgumentEnd(kind)
+					})
+				},
+				func() (ExprNode, error) {
+					return p.parseExpression(isArgumentEnd)
+				},
+			)
+			if err != nil {
+				return nil, nil, err
+			}
+			pending = append(pending, let)
+		case p.currTok.Kind == IDENT && p.nextTok.Kind == LPAREN:
+			call, err := p.parseCall()
+			if err != nil {
+				return nil, nil, err
+			}
+			pending = append(pending, call)
+		case p.currTok.Kind == IDENT && isStackWord(p.currTok.Value):
+			flush()
+			nodes = append(nodes, &StackOpNode{Word: p.currTok.Value})
+			p.advance()
+		case p.currTok.Kind == IDENT:
+			pending = append(pending, p.parseIdentifier())
+		case p.currTok.Kind == COND:
+			// Only the taken branch may run, so both of them have to be
+			// known while compiling the line.
+			if len(pending) < 3 {
+				return nil, nil, fmt.Errorf(
+					"The conditional needs its three operands on the same line at line %d, column %d.",
+					p.currTok.Pos.Row,
+					p.currTok.Pos.Col,
+				)
+			}
+			p.advance()
+			cond := &ConditionalNode{
+				Cond: pending[len(pending)-3],
+				Then: pending[len(pending)-2],
+				Else: pending[len(pending)-1],
+			}
+			pending = append(pending[:len(pending)-3], cond)
+		case isUnaryOperator(p.currTok.Kind) || isBinaryOperator(p.currTok.Kind):
+			op := p.currTok.Kind
+			if len(pending) < arity(op) && isLogicalOperator(op) {
+				return nil, nil, fmt.Errorf(
+					"The `%s` operator needs its operands on the same line at line %d, column %d.",
+					op,
+					p.currTok.Pos.Row,
+					p.currTok.Pos.Col,
+				)
+			}
+			p.advance()
+			if len(pending) < arity(op) {
+				flush()
+				nodes = append(nodes, &OperatorNode{Op: op})
+			} else if arity(op) == 1 {
+				pending[len(pending)-1] = &UnaryOpNode{Operand: pending[len(pending)-1], Op: op}
+			} else {
+				left, right := pending[len(pending)-2], pending[len(pending)-1]
+				pending = append(pending[:len(pending)-2], &BinaryOpNode{Left: left, Op: op, Right: right})
+			}
+		default:
+			return nil, nil, fmt.Errorf(
+				"Unexpected token `%s` at line %d, column %d.",
+				p.currTok.Kind,
+				p.currTok.Pos.Row,
+				p.currTok.Pos.Col,
+			)
+		}
+		if len(pending) > 0 {
+			p.mark(pending[len(pending)-1], pos)
+		}
+		if len(nodes) > 0 {
+			p.mark(nodes[len(nodes)-1], pos)
+		}
+	}
+	return nodes, pending, nil
+}
+
+func (p *PostfixParser) parseExpression(stop func(TokenKind) bool) (ExprNode, error) {
+	pos := p.currTok.Pos
+	nodes, pending, err := p.parseSequence(stop)
+	if err != nil {
+		return nil, err
+	} else if len(nodes) > 0 || len(pending) != 1 {
+		return nil, fmt.Errorf(
+			"Expected exactly one value from the expression at line %d, column %d.",
+			pos.Row,
+			pos.Col,
+		)
+	}
+	return pending[0], nil
+}
+
+// Without parentheses around it a lambda body would swallow the rest of the
+// line, so postfix lambdas are written as `fn(x)(x x *)`.
+func (p *PostfixParser) parseLambda() (*LambdaNode, error) {
+	if err := p.expectKind(FN); err != nil {
+		return nil, err
+	}
+	params, err := p.parseParameters()
+	if err != nil {
+		return nil, err
+	} else if err := p.expectKind(LPAREN); err != nil {
+		return nil, err
+	}
+	body, err := p.parseScoped(params, func() (ExprNode, error) {
+		return p.parseExpression(func(kind TokenKind) bool {
+			return kind == RPAREN || isStatementEnd(kind)
+		})
+	})
+	if err != nil {
+		return nil, err
+	} else if err := p.expectKind(RPAREN); err != nil {
+		return nil, err
+	}
+	return &LambdaNode{Params: params, Body: body}, nil
+}
+
+func (p *PostfixParser) parseCall() (*CallNode, error) {
+	callee := p.parseIdentifier()
+	if err := p.expectKind(LPAREN); err != nil {
+		return nil, err
+	}
+	var args []ExprNode
+	for p.currTok.Kind != RPAREN {
+		arg, err := p.parseExpression(isArgumentEnd)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.currTok.Kind != COMMA {
+			break
+		}
+		p.advance()
+	}
+	if err := p.expectKind(RPAREN); err != nil {
+		return nil, err
+	}
+	return &CallNode{Callee: callee, Args: args}, nil
+}
+
+func (p *PostfixParser) parseVariableDeclaration() (*VariableDeclNode, error) {
+	variable := p.parseIdentifier()
+	if err := p.expectKind(EQUAL); err != nil {
+		return nil, err
+	}
+	value, err := p.parseExpression(isStatementEnd)
+	if err != nil {
+		return nil, err
+	}
+	return &VariableDeclNode{Variable: variable, Value: value}, nil
+}
+
+func (p *PostfixParser) parseFunctionDeclaration() (*FunctionDeclNode, error) {
+	name, params, err := p.parseFunctionSignature()
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.parseScoped(params, func() (ExprNode, error) {
+		return p.parseExpression(isStatementEnd)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &FunctionDeclNode{Name: name, Params: params, Body: body}, nil
+}
+
+func (p *PostfixParser) parseStatement() ([]ASTNode, error) {
+	if p.currTok.Kind == DEF {
+		stmt, err := p.parseFunctionDeclaration()
+		if err != nil {
+			return nil, err
+		}
+		return []ASTNode{stmt}, nil
+	} else if p.currTok.Kind == CONST {
+		stmt, err := p.parseConstantDeclaration(p.parseVariableDeclaration)
+		if err != nil {
+			return nil, err
+		}
+		return []ASTNode{stmt}, nil
+	} else if p.currTok.Kind == IDENT && p.nextTok.Kind == EQUAL {
+		stmt, err := p.parseVariableDeclaration()
+		if err != nil {
+			return nil, err
+		}
+		return []ASTNode{stmt}, nil
+	}
+
+	nodes, pending, err := p.parseSequence(isStatementEnd)
+	if err != nil {
+		return nil, err
+	}
+	for _, expr := range pending {
+		nodes = append(nodes, expr)
+	}
+	return nodes, nil
+}
+
+func (p *PostfixParser) Parse() error {
+	return p.parseProgram(p.parseStatement)
+}
+
+func NewPostfixParser(tokens []Token, options ...ParserOption) (*PostfixParser, error) {
+	p := &PostfixParser{Parser: Parser{tokens: tokens}}
+	for _, option := range options {
+		option(&p.Parser)
+	}
+	return p, p.Parse()
+}
@@ -0,0 +1,96 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePostfixExpressions(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []ASTNode
+	}{
+		{"3 4 + 2 *", []ASTNode{
+			&BinaryOpNode{
+				Left: &BinaryOpNode{
+					Left:  &NumberNode{Value: "3"},
+					Op:    ADD,
+					Right: &NumberNode{Value: "4"},
+				},
+				Op:    MUL,
+				Right: &NumberNode{Value: "2"},
+			},
+		}},
+		{"5 ! max(1, 2 3 *)", []ASTNode{
+			&UnaryOpNode{Operand: &NumberNode{Value: "5"}, Op: FACT},
+			&CallNode{
+				Callee: &IdentifierNode{Value: "max"},
+				Args: []ExprNode{
+					&NumberNode{Value: "1"},
+					&BinaryOpNode{
+						Left:  &NumberNode{Value: "2"},
+						Op:    MUL,
+						Right: &NumberNode{Value: "3"},
+					},
+				},
+			},
+		}},
+		{"x = 2 -1 +", []ASTNode{
+			&VariableDeclNode{
+				Variable: &IdentifierNode{Value: "x"},
+				Value: &BinaryOpNode{
+					Left:  &NumberNode{Value: "2"},
+					Op:    ADD,
+					Right: &NumberNode{Value: "-1"},
+				},
+			},
+		}},
+	}
+
+	for _, tt := range tests {
+		l, err := NewLexer(tt.input)
+		if err != nil {
+			t.Fatalf("Failed to tokenize input `%s`: %v", tt.input, err)
+		}
+		p, err := NewPostfixParser(l.Tokens)
+		if err != nil {
+			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", tt.input, err)
+		}
+		if !reflect.DeepEqual(p.Nodes, tt.want) {
+			t.Errorf("Failed to parse postfix expression. Got `%v`, expected `%v`.", p.Nodes, tt.want)
+		}
+	}
+}
+
+func TestParsePostfixStackWords(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []ASTNode
+	}{
+		{"+", []ASTNode{&OperatorNode{Op: ADD}}},
+		{"2 dup *", []ASTNode{
+			&NumberNode{Value: "2"},
+			&StackOpNode{Word: "dup"},
+			&OperatorNode{Op: MUL},
+		}},
+		{"1 swap -", []ASTNode{
+			&NumberNode{Value: "1"},
+			&StackOpNode{Word: "swap"},
+			&OperatorNode{Op: SUB},
+		}},
+	}
+
+	for _, tt := range tests {
+		l, err := NewLexer(tt.input)
+		if err != nil {
+			t.Fatalf("Failed to tokenize input `%s`: %v", tt.input, err)
+		}
+		p, err := NewPostfixParser(l.Tokens)
+		if err != nil {
+			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", tt.input, err)
+		}
+		if !reflect.DeepEqual(p.Nodes, tt.want) {
+			t.Errorf("Failed to parse postfix expression. Got `%v`, expected `%v`.", p.Nodes, tt.want)
+		}
+	}
+}
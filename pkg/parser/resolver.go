@@ -0,0 +1,125 @@
+package parser
+
+import (
+	"github.com/sheikhartin/bytecode-based-calculator/pkg/bytecode"
+)
+
+// A binding tells where the value of an identifier lives: in a global slot,
+// or in a slot of the local scope that is Depth scopes up from the current
+// one.
+type Binding struct {
+	Local bool
+	Depth int
+	Slot  int
+}
+
+// The scope of a series keeps its index in the first slot and the upper bound
+// in the second, under a name no identifier can have.
+const seriesUpper = "<upper>"
+
+// The resolver runs between parsing and generating bytecode. Scoping is
+// lexical, so every identifier can be bound to its slot before anything runs;
+// names that are not bound by a parameter, `let` or series are globals.
+type Resolver struct {
+	ast     []ASTNode
+	scopes  [][]string
+	Symbols bytecode.SymbolTable
+}
+
+func (r *Resolver) declare(ident *IdentifierNode) {
+	scope := len(r.scopes) - 1
+	ident.Binding = Binding{Local: true, Slot: len(r.scopes[scope])}
+	r.scopes[scope] = append(r.scopes[scope], ident.Value)
+}
+
+func (r *Resolver) bind(ident *IdentifierNode) {
+	for depth := 0; depth < len(r.scopes); depth++ {
+		names := r.scopes[len(r.scopes)-1-depth]
+		// A later binding in the same scope hides an earlier one.
+		for slot := len(names) - 1; slot >= 0; slot-- {
+			if names[slot] == ident.Value {
+				ident.Binding = Binding{Local: true, Depth: depth, Slot: slot}
+				return
+			}
+		}
+	}
+	r.bindGlobal(ident)
+}
+
+func (r *Resolver) bindGlobal(ident *IdentifierNode) {
+	ident.Binding = Binding{Slot: r.Symbols.Add(ident.Value)}
+}
+
+// A function gets a scope of its own for its parameters. Named functions do
+// not capture anything, so their bodies only see their parameters and the
+// globals, while a lambda sees the scopes it is created in.
+func (r *Resolver) resolveFunction(params []*IdentifierNode, body ExprNode, closure bool) {
+	outer := r.scopes
+	if !closure {
+		r.scopes = nil
+	}
+	r.scopes = append(r.scopes, nil)
+	for _, param := range params {
+		r.declare(param)
+	}
+	r.resolve(body)
+	r.scopes = outer
+}
+
+func (r *Resolver) resolve(node ASTNode) {
+	switch n := node.(type) {
+	case *IdentifierNode:
+		r.bind(n)
+	case *CallNode:
+		for _, arg := range n.Args {
+			r.resolve(arg)
+		}
+		r.bind(n.Callee)
+	case *UnaryOpNode:
+		r.resolve(n.Operand)
+	case *BinaryOpNode:
+		r.resolve(n.Left)
+		r.resolve(n.Right)
+	case *ConditionalNode:
+		r.resolve(n.Cond)
+		r.resolve(n.Then)
+		r.resolve(n.Else)
+	case *SeriesNode:
+		r.resolve(n.Lower)
+		r.resolve(n.Upper)
+		r.scopes = append(r.scopes, nil)
+		r.declare(n.Index)
+		r.declare(&IdentifierNode{Value: seriesUpper})
+		r.resolve(n.Body)
+		r.scopes = r.scopes[:len(r.scopes)-1]
+	case *LetNode:
+		r.resolve(n.Value)
+		r.scopes = append(r.scopes, nil)
+		r.declare(n.Variable)
+		r.resolve(n.Body)
+		r.scopes = r.scopes[:len(r.scopes)-1]
+	case *VariableDeclNode:
+		r.resolve(n.Value)
+		r.bindGlobal(n.Variable)
+	case *ConstDeclNode:
+		r.resolve(n.Value)
+		r.bindGlobal(n.Variable)
+	case *FunctionDeclNode:
+		r.bindGlobal(n.Name)
+		r.resolveFunction(n.Params, n.Body, false)
+	case *LambdaNode:
+		r.resolveFunction(n.Params, n.Body, true)
+	}
+}
+
+func (r *Resolver) Resolve() {
+	for _, node := range r.ast {
+		r.resolve(node)
+	}
+}
+
+func NewResolver(ast []ASTNode) *Resolver {
+	r := &Resolver{ast: ast}
+	r.Resolve()
+	return r
+}
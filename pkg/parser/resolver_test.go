@@ -0,0 +1,74 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolveBindings(t *testing.T) {
+	tests := []struct {
+		input   string
+		symbols []string
+		want    []Binding
+	}{
+		{"x = 5 ;; + x y", []string{"x", "y"}, []Binding{{Slot: 0}, {Slot: 1}}},
+		{"def f(a, b) = - a b", []string{"f"}, []Binding{{Local: true, Slot: 0}, {Local: true, Slot: 1}}},
+		{"let x = 1 in let y = 2 in + x y", nil, []Binding{{Local: true, Depth: 1}, {Local: true}}},
+		{"let x = 1 in let x = + x 1 in x", nil, []Binding{{Local: true}, {Local: true}}},
+		{"let k = 3 in fn(x) * x k", nil, []Binding{{Local: true}, {Local: true, Depth: 1}}},
+		{"sum(i, 1, n, * i k)", []string{"n", "k"}, []Binding{{Local: true}, {Slot: 1}}},
+		{"let f = fn(x) x in f(2)", nil, []Binding{{Local: true}, {Local: true}}},
+	}
+
+	for _, tt := range tests {
+		l, err := NewLexer(tt.input)
+		if err != nil {
+			t.Fatalf("Failed to tokenize input `%s`: %v", tt.input, err)
+			continue
+		}
+		p, err := NewParser(l.Tokens)
+		if err != nil {
+			t.Fatalf("Failed to initialize parser with tokens from input `%s`: %v", tt.input, err)
+			continue
+		}
+		r := NewResolver(p.Nodes)
+		if !reflect.DeepEqual(r.Symbols.Names, tt.symbols) {
+			t.Errorf("Expected the globals %v for input `%s`, got %v!", tt.symbols, tt.input, r.Symbols.Names)
+		}
+		if got := loadedBindings(p.Nodes[len(p.Nodes)-1]); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Expected the bindings %v for input `%s`, got %v!", tt.want, tt.input, got)
+		}
+	}
+}
+
+// The bindings of the identifiers that are read, in the order they are
+// generated.
+func loadedBindings(node ASTNode) []Binding {
+	var bindings []Binding
+	var walk func(node ASTNode)
+	walk = func(node ASTNode) {
+		switch n := node.(type) {
+		case *IdentifierNode:
+			bindings = append(bindings, n.Binding)
+		case *CallNode:
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+			walk(n.Callee)
+		case *BinaryOpNode:
+			walk(n.Left)
+			walk(n.Right)
+		case *SeriesNode:
+			walk(n.Body)
+		case *LetNode:
+			walk(n.Value)
+			walk(n.Body)
+		case *FunctionDeclNode:
+			walk(n.Body)
+		case *LambdaNode:
+			walk(n.Body)
+		}
+	}
+	walk(node)
+	return bindings
+}
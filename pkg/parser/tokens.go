@@ -14,37 +14,132 @@ const (
 	NUM
 	IDENT
 
+	// Keywords
+	DEF
+	FN
+	IF
+	THEN
+	ELSE
+	AND
+	OR
+	NOT
+	SUM
+	PROD
+	LET
+	IN
+	BXOR
+	TO
+	CONST
+
 	// Operators
 	FACT
 	ADD
 	SUB
 	MUL
 	DIV
+	IDIV
 	MOD
 	POW
+	COND
+	LT
+	LE
+	GT
+	GE
+	EQ
+	NE
+	BAND
+	BOR
+	BNOT
+	SHL
+	SHR
+	SQRT
 
 	// Symbols
 	LPAREN
 	RPAREN
 	COMMA
 	EQUAL
+	SEMI
 )
 
 var tokenNames = map[TokenKind]string{
 	EOF:    "EOF",
 	NUM:    "NUM",
 	IDENT:  "IDENT",
+	DEF:    "DEF",
+	FN:     "FN",
+	IF:     "IF",
+	THEN:   "THEN",
+	ELSE:   "ELSE",
+	AND:    "AND",
+	OR:     "OR",
+	NOT:    "NOT",
+	SUM:    "SUM",
+	PROD:   "PROD",
+	LET:    "LET",
+	IN:     "IN",
+	BXOR:   "BXOR",
+	TO:     "TO",
+	CONST:  "CONST",
 	FACT:   "FACT",
 	ADD:    "ADD",
 	SUB:    "SUB",
 	MUL:    "MUL",
 	DIV:    "DIV",
+	IDIV:   "IDIV",
 	MOD:    "MOD",
 	POW:    "POW",
+	COND:   "COND",
+	LT:     "LT",
+	LE:     "LE",
+	GT:     "GT",
+	GE:     "GE",
+	EQ:     "EQ",
+	NE:     "NE",
+	BAND:   "BAND",
+	BOR:    "BOR",
+	BNOT:   "BNOT",
+	SHL:    "SHL",
+	SHR:    "SHR",
+	SQRT:   "SQRT",
 	LPAREN: "LPAREN",
 	RPAREN: "RPAREN",
 	COMMA:  "COMMA",
 	EQUAL:  "EQUAL",
+	SEMI:   "SEMI",
+}
+
+var keywords = map[string]TokenKind{
+	"def":   DEF,
+	"fn":    FN,
+	"if":    IF,
+	"then":  THEN,
+	"else":  ELSE,
+	"and":   AND,
+	"or":    OR,
+	"not":   NOT,
+	"sum":   SUM,
+	"prod":  PROD,
+	"let":   LET,
+	"in":    IN,
+	"xor":   BXOR,
+	"to":    TO,
+	"const": CONST,
+}
+
+// Common mathematical symbols are alternative spellings of the operators.
+var mathSymbols = map[rune]TokenKind{
+	'×': MUL,
+	'·': MUL,
+	'÷': DIV,
+	'−': SUB,
+	'≤': LE,
+	'≥': GE,
+	'≠': NE,
+	'¬': NOT,
+	'∧': AND,
+	'∨': OR,
+	'√': SQRT,
 }
 
 func (t TokenKind) String() string {
@@ -55,10 +150,35 @@ type Position struct {
 	Row, Col int
 }
 
+type TriviaKind int
+
+const (
+	WHITESPACE TriviaKind = iota
+	COMMENT
+)
+
+var triviaNames = map[TriviaKind]string{
+	WHITESPACE: "WHITESPACE",
+	COMMENT:    "COMMENT",
+}
+
+func (t TriviaKind) String() string {
+	return triviaNames[t]
+}
+
+// Trivia is the text between tokens that the parsers ignore, i.e. spaces,
+// line breaks inside parentheses and comments.
+type Trivia struct {
+	Pos  Position
+	Kind TriviaKind
+	Text string
+}
+
 type Token struct {
-	Pos   Position
-	Kind  TokenKind
-	Value string
+	Pos     Position
+	Kind    TokenKind
+	Value   string
+	Leading []Trivia
 }
 
 func (t Token) String() string {
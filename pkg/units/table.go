@@ -0,0 +1,95 @@
+package units
+
+import (
+	"math/big"
+)
+
+type definition struct {
+	scale string
+	dim   Dimension
+}
+
+func derived(dims ...Dimension) Dimension {
+	var d Dimension
+	for _, dim := range dims {
+		d = d.Add(dim)
+	}
+	return d
+}
+
+var (
+	area     = derived(Length, Length)
+	volume   = derived(Length, Length, Length)
+	force    = derived(Mass, Length, Time.Scale(-2))
+	energy   = derived(force, Length)
+	power    = derived(energy, Time.Scale(-1))
+	charge   = derived(Current, Time)
+	voltage  = derived(power, Current.Scale(-1))
+	pressure = derived(force, Length.Scale(-2))
+)
+
+// Scales are exact decimals or fractions so that the imperial units, which are
+// all defined in terms of SI ones, convert without rounding.
+var table = map[string]definition{
+	// SI base units
+	"m":   {"1", Length},
+	"kg":  {"1", Mass},
+	"s":   {"1", Time},
+	"A":   {"1", Current},
+	"K":   {"1", Temperature},
+	"mol": {"1", Amount},
+	"cd":  {"1", Luminosity},
+
+	// Scaled SI units
+	"km":     {"1000", Length},
+	"cm":     {"0.01", Length},
+	"mm":     {"0.001", Length},
+	"g":      {"0.001", Mass},
+	"mg":     {"0.000001", Mass},
+	"ms":     {"0.001", Time},
+	"minute": {"60", Time},
+	"h":      {"3600", Time},
+	"day":    {"86400", Time},
+	"ha":     {"10000", area},
+	"L":      {"0.001", volume},
+	"mL":     {"0.000001", volume},
+
+	// Derived SI units
+	"Hz":  {"1", Time.Scale(-1)},
+	"N":   {"1", force},
+	"J":   {"1", energy},
+	"kJ":  {"1000", energy},
+	"W":   {"1", power},
+	"kW":  {"1000", power},
+	"Pa":  {"1", pressure},
+	"kPa": {"1000", pressure},
+	"C":   {"1", charge},
+	"V":   {"1", voltage},
+	"ohm": {"1", derived(voltage, Current.Scale(-1))},
+
+	// Imperial and US customary units
+	"inch": {"0.0254", Length},
+	"ft":   {"0.3048", Length},
+	"yd":   {"0.9144", Length},
+	"mi":   {"1609.344", Length},
+	"oz":   {"0.028349523125", Mass},
+	"lb":   {"0.45359237", Mass},
+	"gal":  {"0.003785411784", volume},
+	"lbf":  {"4.4482216152605", force},
+	"psi":  {"44482216152605/6451600000", pressure},
+	"acre": {"4046.8564224", area},
+}
+
+func Lookup(name string) (Unit, bool) {
+	def, ok := table[name]
+	if !ok {
+		return Unit{}, false
+	}
+	scale, _ := new(big.Rat).SetString(def.scale)
+	return Unit{Dim: def.dim, Scale: scale, Terms: map[string]int{name: 1}}, true
+}
+
+func IsUnit(name string) bool {
+	_, ok := table[name]
+	return ok
+}
@@ -0,0 +1,186 @@
+package units
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// The exponents of the SI base quantities: length, mass, time, electric
+// current, temperature, amount of substance and luminous intensity.
+type Dimension [7]int
+
+var (
+	Length      = Dimension{1, 0, 0, 0, 0, 0, 0}
+	Mass        = Dimension{0, 1, 0, 0, 0, 0, 0}
+	Time        = Dimension{0, 0, 1, 0, 0, 0, 0}
+	Current     = Dimension{0, 0, 0, 1, 0, 0, 0}
+	Temperature = Dimension{0, 0, 0, 0, 1, 0, 0}
+	Amount      = Dimension{0, 0, 0, 0, 0, 1, 0}
+	Luminosity  = Dimension{0, 0, 0, 0, 0, 0, 1}
+)
+
+func (d Dimension) Add(other Dimension) Dimension {
+	for i := range d {
+		d[i] += other[i]
+	}
+	return d
+}
+
+func (d Dimension) Scale(n int) Dimension {
+	for i := range d {
+		d[i] *= n
+	}
+	return d
+}
+
+func (d Dimension) IsZero() bool {
+	return d == Dimension{}
+}
+
+// A unit is a product of named units raised to integer powers. Its scale is
+// its size in SI base units, kept exact so that conversions between exactly
+// defined units like feet and meters stay exact in the rational mode.
+type Unit struct {
+	Dim   Dimension
+	Scale *big.Rat
+	Terms map[string]int
+}
+
+func (u Unit) String() string {
+	var names []string
+	for name := range u.Terms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var numerator, denominator []string
+	for _, name := range names {
+		exp := u.Terms[name]
+		term := name
+		if exp < 0 {
+			exp = -exp
+		}
+		if exp != 1 {
+			term = fmt.Sprintf("%s^%d", name, exp)
+		}
+		if u.Terms[name] > 0 {
+			numerator = append(numerator, term)
+		} else {
+			denominator = append(denominator, term)
+		}
+	}
+
+	text := strings.Join(numerator, "*")
+	if text == "" {
+		text = "1"
+	}
+	if len(denominator) > 0 {
+		text += "/" + strings.Join(denominator, "/")
+	}
+	return text
+}
+
+func (u Unit) IsDimensionless() bool {
+	return u.Dim.IsZero()
+}
+
+func (u Unit) combine(other Unit, sign int) Unit {
+	terms := make(map[string]int, len(u.Terms)+len(other.Terms))
+	for name, exp := range u.Terms {
+		terms[name] = exp
+	}
+	for name, exp := range other.Terms {
+		if terms[name] += sign * exp; terms[name] == 0 {
+			delete(terms, name)
+		}
+	}
+
+	scale := new(big.Rat).Mul(u.Scale, other.Scale)
+	if sign < 0 {
+		scale.Quo(u.Scale, other.Scale)
+	}
+	return Unit{Dim: u.Dim.Add(other.Dim.Scale(sign)), Scale: scale, Terms: terms}
+}
+
+func (u Unit) Mul(other Unit) Unit {
+	return u.combine(other, 1)
+}
+
+func (u Unit) Div(other Unit) Unit {
+	return u.combine(other, -1)
+}
+
+func (u Unit) Pow(n int) Unit {
+	terms := make(map[string]int, len(u.Terms))
+	for name, exp := range u.Terms {
+		if n != 0 {
+			terms[name] = exp * n
+		}
+	}
+
+	num := new(big.Int).Exp(u.Scale.Num(), big.NewInt(int64(abs(n))), nil)
+	denom := new(big.Int).Exp(u.Scale.Denom(), big.NewInt(int64(abs(n))), nil)
+	scale := new(big.Rat).SetFrac(num, denom)
+	if n < 0 {
+		scale.Inv(scale)
+	}
+	return Unit{Dim: u.Dim.Scale(n), Scale: scale, Terms: terms}
+}
+
+// Root takes the n-th root of the unit, which only exists when every
+// exponent is a multiple of n.
+func (u Unit) Root(n int) (Unit, bool) {
+	if n <= 0 {
+		return Unit{}, false
+	}
+	var dim Dimension
+	for i, exp := range u.Dim {
+		if exp%n != 0 {
+			return Unit{}, false
+		}
+		dim[i] = exp / n
+	}
+	terms := make(map[string]int, len(u.Terms))
+	for name, exp := range u.Terms {
+		if exp%n != 0 {
+			return Unit{}, false
+		}
+		terms[name] = exp / n
+	}
+
+	scale := new(big.Rat)
+	num, numExact := intRoot(u.Scale.Num(), n)
+	denom, denomExact := intRoot(u.Scale.Denom(), n)
+	if numExact && denomExact {
+		scale.SetFrac(num, denom)
+	} else {
+		f, _ := u.Scale.Float64()
+		scale.SetFloat64(math.Pow(f, 1/float64(n)))
+	}
+	return Unit{Dim: dim, Scale: scale, Terms: terms}, true
+}
+
+func intRoot(x *big.Int, n int) (*big.Int, bool) {
+	f, _ := new(big.Float).SetInt(x).Float64()
+	root, _ := big.NewFloat(math.Round(math.Pow(f, 1/float64(n)))).Int(nil)
+	power := new(big.Int).Exp(root, big.NewInt(int64(n)), nil)
+	return root, power.Cmp(x) == 0
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// Ratio is the factor that turns an amount of this unit into an amount of
+// the other one.
+func (u Unit) Ratio(other Unit) *big.Rat {
+	return new(big.Rat).Quo(u.Scale, other.Scale)
+}
+
+var Dimensionless = Unit{Scale: big.NewRat(1, 1)}
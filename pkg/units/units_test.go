@@ -0,0 +1,61 @@
+package units
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestUnitArithmetic(t *testing.T) {
+	m, _ := Lookup("m")
+	s, _ := Lookup("s")
+	km, _ := Lookup("km")
+	h, _ := Lookup("h")
+
+	tests := []struct {
+		unit  Unit
+		name  string
+		scale *big.Rat
+	}{
+		{m.Div(s), "m/s", big.NewRat(1, 1)},
+		{km.Div(h), "km/h", big.NewRat(5, 18)},
+		{m.Div(s.Pow(2)), "m/s^2", big.NewRat(1, 1)},
+		{s.Pow(-1), "1/s", big.NewRat(1, 1)},
+		{km.Mul(m).Div(m), "km", big.NewRat(1000, 1)},
+	}
+
+	for _, tt := range tests {
+		if got := tt.unit.String(); got != tt.name {
+			t.Errorf("Wrong unit name! Got `%s`, want `%s`.", got, tt.name)
+		} else if tt.unit.Scale.Cmp(tt.scale) != 0 {
+			t.Errorf("Wrong scale for `%s`! Got `%s`, want `%s`.", tt.name, tt.unit.Scale, tt.scale)
+		}
+	}
+}
+
+func TestUnitRoots(t *testing.T) {
+	m, _ := Lookup("m")
+	ha, _ := Lookup("ha")
+
+	if root, ok := m.Pow(2).Root(2); !ok || root.String() != "m" {
+		t.Errorf("Expected the square root of `m^2` to be `m`, got `%s`.", root)
+	}
+	if root, ok := ha.Root(2); ok {
+		t.Errorf("Expected no square root of `ha`, got `%s`.", root)
+	}
+	if _, ok := m.Root(2); ok {
+		t.Errorf("Expected no square root of `m`.")
+	}
+}
+
+func TestImperialUnitsAreExact(t *testing.T) {
+	ft, _ := Lookup("ft")
+	inch, _ := Lookup("inch")
+	mi, _ := Lookup("mi")
+
+	if ratio := ft.Ratio(inch); ratio.Cmp(big.NewRat(12, 1)) != 0 {
+		t.Errorf("Expected 12 inches in a foot, got `%s`.", ratio)
+	}
+	if ratio := mi.Ratio(ft); ratio.Cmp(big.NewRat(5280, 1)) != 0 {
+		t.Errorf("Expected 5280 feet in a mile, got `%s`.", ratio)
+	}
+}